@@ -0,0 +1,56 @@
+// Package audio holds rendered audio in memory, and reads and writes it as WAV files
+package audio
+
+// Buffer is a block of audio, stored as one slice of samples per channel - samples run from -1 to 1
+type Buffer struct {
+	// SampleRate the number of frames per second
+	SampleRate int
+	// Channels the samples of each channel, all of the same length
+	Channels [][]float32
+}
+
+// NewBuffer creates a silent buffer of frames frames
+func NewBuffer(sampleRate int, channels int, frames int) *Buffer {
+	buffer := &Buffer{SampleRate: sampleRate, Channels: make([][]float32, channels)}
+	for c := range buffer.Channels {
+		buffer.Channels[c] = make([]float32, frames)
+	}
+	return buffer
+}
+
+// NumChannels returns the number of channels in the buffer
+func (b *Buffer) NumChannels() int {
+	return len(b.Channels)
+}
+
+// Frames returns the number of frames (samples per channel) in the buffer
+func (b *Buffer) Frames() int {
+	if len(b.Channels) == 0 {
+		return 0
+	}
+	return len(b.Channels[0])
+}
+
+// WithChannels returns the buffer with its channels mixed down to mono or spread out from mono - the buffer itself is returned
+// when it already has channels channels, or when there's no obvious way to change them
+func (b *Buffer) WithChannels(channels int) *Buffer {
+	switch {
+	case channels == b.NumChannels():
+		return b
+	case channels == 1:
+		mono := NewBuffer(b.SampleRate, 1, b.Frames())
+		for _, samples := range b.Channels {
+			for i, sample := range samples {
+				mono.Channels[0][i] += sample / float32(b.NumChannels())
+			}
+		}
+		return mono
+	case b.NumChannels() == 1:
+		spread := NewBuffer(b.SampleRate, channels, b.Frames())
+		for c := range spread.Channels {
+			copy(spread.Channels[c], b.Channels[0])
+		}
+		return spread
+	}
+	return b
+}
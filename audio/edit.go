@@ -0,0 +1,82 @@
+package audio
+
+import (
+	"math"
+)
+
+// SoundingRange returns the frames between which the buffer is louder than thresholdDB (in dBFS) - the end is the frame after
+// the last one above it. It returns false when the buffer never gets that loud
+func SoundingRange(b *Buffer, thresholdDB float64) (int, int, bool) {
+	threshold := float32(decibelsToAmplitude(thresholdDB))
+	start, end := b.Frames(), 0
+	for _, samples := range b.Channels {
+		for i := 0; i < start; i++ {
+			if samples[i] > threshold || samples[i] < -threshold {
+				start = i
+				break
+			}
+		}
+		for i := len(samples) - 1; i >= end; i-- {
+			if samples[i] > threshold || samples[i] < -threshold {
+				end = i + 1
+				break
+			}
+		}
+	}
+	if start >= end {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+// Slice returns the frames of the buffer from start up to end - frames past the end of the buffer are silent
+func (b *Buffer) Slice(start int, end int) *Buffer {
+	slice := NewBuffer(b.SampleRate, b.NumChannels(), end-start)
+	for c, samples := range b.Channels {
+		if start < len(samples) {
+			copy(slice.Channels[c], samples[start:])
+		}
+	}
+	return slice
+}
+
+// Padded returns the buffer with before frames of silence added to its start and after frames added to its end
+func (b *Buffer) Padded(before int, after int) *Buffer {
+	padded := NewBuffer(b.SampleRate, b.NumChannels(), before+b.Frames()+after)
+	for c, samples := range b.Channels {
+		copy(padded.Channels[c][before:], samples)
+	}
+	return padded
+}
+
+// FadeIn fades the first frames frames of the buffer in from silence
+func FadeIn(b *Buffer, frames int) {
+	frames = minFrames(frames, b.Frames())
+	for _, samples := range b.Channels {
+		for i := 0; i < frames; i++ {
+			samples[i] *= fadeGain(float64(i) / float64(frames))
+		}
+	}
+}
+
+// FadeOut fades the last frames frames of the buffer out to silence
+func FadeOut(b *Buffer, frames int) {
+	frames = minFrames(frames, b.Frames())
+	for _, samples := range b.Channels {
+		for i := 0; i < frames; i++ {
+			samples[len(samples)-1-i] *= fadeGain(float64(i) / float64(frames))
+		}
+	}
+}
+
+// Returns the gain at position (from 0 to 1) through a fade in - a raised cosine, so the fade starts and ends gently
+func fadeGain(position float64) float32 {
+	return float32(0.5 - 0.5*math.Cos(math.Pi*position))
+}
+
+func minFrames(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,218 @@
+package audio
+
+import (
+	"math"
+)
+
+// Effect processes a buffer, returning the processed audio - the buffer passed in may be changed or reused
+type Effect interface {
+	Apply(b *Buffer) *Buffer
+}
+
+// ApplyEffects runs a buffer through a chain of effects, in order
+func ApplyEffects(b *Buffer, effects []Effect) *Buffer {
+	for _, effect := range effects {
+		b = effect.Apply(b)
+	}
+	return b
+}
+
+// Copy returns a copy of the buffer that can be changed without changing the buffer
+func (b *Buffer) Copy() *Buffer {
+	return b.Slice(0, b.Frames())
+}
+
+// EQBand is a band of a parametric equalizer, boosting or cutting the frequencies around Frequency
+type EQBand struct {
+	// Frequency the centre of the band, in Hz
+	Frequency float64
+	// Gain how much the band is boosted (positive) or cut (negative), in dB
+	Gain float64
+	// Q how narrow the band is - higher is narrower
+	Q float64
+}
+
+// Apply filters each channel of the buffer with the band's peaking filter
+func (e EQBand) Apply(b *Buffer) *Buffer {
+	frequency := math.Min(e.Frequency, 0.49*float64(b.SampleRate))
+	amplitude := math.Pow(10, e.Gain/40)
+	omega := 2 * math.Pi * frequency / float64(b.SampleRate)
+	alpha := math.Sin(omega) / (2 * e.Q)
+	a0 := 1 + alpha/amplitude
+	for _, samples := range b.Channels {
+		filter := &biquad{
+			b0: (1 + alpha*amplitude) / a0,
+			b1: -2 * math.Cos(omega) / a0,
+			b2: (1 - alpha*amplitude) / a0,
+			a1: -2 * math.Cos(omega) / a0,
+			a2: (1 - alpha/amplitude) / a0,
+		}
+		for i, sample := range samples {
+			samples[i] = float32(filter.process(float64(sample)))
+		}
+	}
+	return b
+}
+
+// the compressor reacts to a rise in level this quickly, and lets go this slowly
+const (
+	compressorAttackSeconds  = 0.01
+	compressorReleaseSeconds = 0.15
+)
+
+// Compressor evens out the level of a buffer by turning down whatever goes above Threshold
+type Compressor struct {
+	// Threshold the level (in dBFS) above which the buffer is turned down
+	Threshold float64
+	// Ratio how many dB louder the input has to get above the threshold for the output to get 1 dB louder
+	Ratio float64
+	// MakeupGain the gain (in dB) added after compressing, to bring the level back up
+	MakeupGain float64
+}
+
+// Apply compresses the buffer - the channels are turned down together, so the compressor doesn't move the stereo image
+func (c Compressor) Apply(b *Buffer) *Buffer {
+	attack := math.Exp(-1 / (compressorAttackSeconds * float64(b.SampleRate)))
+	release := math.Exp(-1 / (compressorReleaseSeconds * float64(b.SampleRate)))
+	// the gain reduction (in dB) follows the level with the attack and release, rather than jumping with every sample
+	reduction := 0.0
+	for i := 0; i < b.Frames(); i++ {
+		peak := 0.0
+		for _, samples := range b.Channels {
+			peak = math.Max(peak, math.Abs(float64(samples[i])))
+		}
+		target := 0.0
+		if level := amplitudeToDecibels(peak); level > c.Threshold {
+			target = (level - c.Threshold) * (1 - 1/c.Ratio)
+		}
+		coefficient := release
+		if target > reduction {
+			coefficient = attack
+		}
+		reduction = target + (reduction-target)*coefficient
+
+		gain := float32(decibelsToAmplitude(c.MakeupGain - reduction))
+		for _, samples := range b.Channels {
+			samples[i] *= gain
+		}
+	}
+	return b
+}
+
+// the delays (in samples at 44.1 kHz) of the reverb's comb and all-pass filters
+var (
+	reverbCombDelays    = []int{1116, 1188, 1277, 1356, 1422, 1491, 1557, 1617}
+	reverbAllPassDelays = []int{556, 441, 341, 225}
+)
+
+// how much longer the delays of each channel after the first are, which keeps the channels from sounding alike
+const reverbChannelSpread = 23
+
+// the reverb's input is scaled down before going into the comb filters, whose outputs add up to far more than it, and its
+// output is scaled back up so a Wet of 1 is about as loud as the dry sound
+const (
+	reverbInputGain = 0.015
+	reverbWetScale  = 3
+)
+
+// the reverb rings on for up to this long after the end of the buffer - the part of it that can be heard is kept
+const reverbTailSeconds = 3
+
+// Reverb is an algorithmic reverb in the style of Freeverb - banks of feedback comb filters in parallel, followed by all-pass
+// filters in series
+type Reverb struct {
+	// Wet the level of the reverb added to the buffer, from 0 (none) to 1
+	Wet float64
+	// RoomSize how long the reverb rings on, from 0 to 1
+	RoomSize float64
+	// Damping how quickly the high frequencies die away, from 0 to 1
+	Damping float64
+}
+
+// Apply adds the reverb to the buffer, lengthening it to fit the reverb's tail
+func (r Reverb) Apply(b *Buffer) *Buffer {
+	tailFrames := reverbTailSeconds * b.SampleRate
+	input := b.Padded(0, tailFrames)
+	output := input.Copy()
+	scale := float64(b.SampleRate) / 44100
+	feedback := 0.7 + 0.28*r.RoomSize
+	damping := 0.4 * r.Damping
+
+	for c, samples := range output.Channels {
+		var combs []*combFilter
+		for _, delay := range reverbCombDelays {
+			combs = append(combs, newCombFilter(int(float64(delay+c*reverbChannelSpread)*scale), feedback, damping))
+		}
+		var allPasses []*allPassFilter
+		for _, delay := range reverbAllPassDelays {
+			allPasses = append(allPasses, newAllPassFilter(int(float64(delay+c*reverbChannelSpread)*scale)))
+		}
+
+		for i := range samples {
+			// every channel of the reverb is fed the sum of the input's channels, as a room would be
+			in := 0.0
+			for _, inputSamples := range input.Channels {
+				in += float64(inputSamples[i]) * reverbInputGain
+			}
+			wet := 0.0
+			for _, comb := range combs {
+				wet += comb.process(in)
+			}
+			for _, allPass := range allPasses {
+				wet = allPass.process(wet)
+			}
+			samples[i] += float32(r.Wet * reverbWetScale * wet)
+		}
+	}
+
+	// the silent end of the tail is cut off again
+	_, end, ok := SoundingRange(output, silenceDecibels)
+	if !ok || end < b.Frames() {
+		end = b.Frames()
+	}
+	return output.Slice(0, end)
+}
+
+// the level (in dBFS) below which audio can't be heard in a 16-bit file
+const silenceDecibels = -96
+
+// combFilter is a feedback delay line with a low-pass filter in the feedback
+type combFilter struct {
+	buffer   []float64
+	index    int
+	feedback float64
+	damping  float64
+	filtered float64
+}
+
+func newCombFilter(delay int, feedback float64, damping float64) *combFilter {
+	return &combFilter{buffer: make([]float64, delay), feedback: feedback, damping: damping}
+}
+
+func (f *combFilter) process(x float64) float64 {
+	y := f.buffer[f.index]
+	f.filtered = y*(1-f.damping) + f.filtered*f.damping
+	f.buffer[f.index] = x + f.filtered*f.feedback
+	f.index = (f.index + 1) % len(f.buffer)
+	return y
+}
+
+// allPassFilter smears the echoes of the comb filters into a smooth tail without changing the reverb's tone
+type allPassFilter struct {
+	buffer []float64
+	index  int
+}
+
+// the feedback of every all-pass filter
+const allPassFeedback = 0.5
+
+func newAllPassFilter(delay int) *allPassFilter {
+	return &allPassFilter{buffer: make([]float64, delay)}
+}
+
+func (f *allPassFilter) process(x float64) float64 {
+	delayed := f.buffer[f.index]
+	f.buffer[f.index] = x + delayed*allPassFeedback
+	f.index = (f.index + 1) % len(f.buffer)
+	return delayed - x
+}
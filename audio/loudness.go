@@ -0,0 +1,295 @@
+package audio
+
+import (
+	"math"
+)
+
+// Loudness is the loudness of a buffer, measured as ITU-R BS.1770 (and EBU R128) describe
+type Loudness struct {
+	// Integrated the gated loudness of the whole buffer, in LUFS - -Inf for a silent buffer
+	Integrated float64
+	// TruePeak the highest peak of the buffer's waveform, including between samples, in dBTP
+	TruePeak float64
+}
+
+// measurement blocks are 400 ms long and start every 100 ms
+const (
+	loudnessBlockSeconds = 0.4
+	loudnessBlockSteps   = 4
+)
+
+// blocks quieter than the absolute gate, or quieter than the relative gate below the loudness of the louder blocks, are left
+// out of the integrated loudness
+const (
+	absoluteGateLUFS = -70
+	relativeGateLU   = -10
+)
+
+// true peaks are found by oversampling four times, interpolating with a windowed sinc of this many taps per phase
+const (
+	truePeakOversampling = 4
+	truePeakTaps         = 12
+)
+
+// the limiter looks this far ahead to start turning down before a peak, and takes about this long to come back up after one
+const (
+	limiterLookaheadSeconds = 0.005
+	limiterReleaseSeconds   = 0.05
+)
+
+// the most times the gain is made up after limiting when normalizing
+const normalizeAttempts = 4
+
+// MeasureLoudness returns the integrated loudness and true peak of the buffer
+func MeasureLoudness(b *Buffer) Loudness {
+	return Loudness{Integrated: integratedLoudness(b), TruePeak: amplitudeToDecibels(truePeak(b))}
+}
+
+// Normalize changes the gain of the buffer so its integrated loudness is targetLUFS, limiting it so its true peak stays at or
+// below peakLimitDBTP - it returns the loudness before and after. A silent buffer is left as it is
+func Normalize(b *Buffer, targetLUFS float64, peakLimitDBTP float64) (Loudness, Loudness) {
+	// oversampling the whole buffer is slow, so the true peak is only measured again after limiting - a change of gain
+	// changes it by the same amount
+	peak := truePeak(b)
+	measured := Loudness{Integrated: integratedLoudness(b), TruePeak: amplitudeToDecibels(peak)}
+	if math.IsInf(measured.Integrated, -1) {
+		return measured, measured
+	}
+
+	// limiting the peaks takes some of the loudness with it, so the gain is made up and the peaks limited again a few times
+	peakLimit := decibelsToAmplitude(peakLimitDBTP)
+	loudness := measured.Integrated
+	for attempt := 0; attempt < normalizeAttempts; attempt++ {
+		gain := decibelsToAmplitude(targetLUFS - loudness)
+		applyGain(b, gain)
+		peak *= gain
+		if peak <= peakLimit {
+			break
+		}
+		limitPeaks(b, peakLimit)
+		loudness = integratedLoudness(b)
+		peak = truePeak(b)
+	}
+	// the limiter only sees the samples themselves, so whatever peaks it leaves between them are turned down as a whole
+	if peak > peakLimit {
+		applyGain(b, peakLimit/peak)
+		peak = peakLimit
+	}
+	return measured, Loudness{Integrated: integratedLoudness(b), TruePeak: amplitudeToDecibels(peak)}
+}
+
+// Returns the gated loudness of the buffer in LUFS
+func integratedLoudness(b *Buffer) float64 {
+	blockFrames := int(loudnessBlockSeconds * float64(b.SampleRate))
+	stepFrames := blockFrames / loudnessBlockSteps
+	if blockFrames == 0 || b.Frames() < blockFrames {
+		return math.Inf(-1)
+	}
+
+	// the mean square of each 100 ms step of every channel after K-weighting, summed over the channels (each weighted 1, as
+	// the left, right and centre channels are)
+	stepPowers := make([]float64, b.Frames()/stepFrames)
+	for _, samples := range b.Channels {
+		filters := kWeightingFilters(b.SampleRate)
+		for i := 0; i < len(stepPowers)*stepFrames; i++ {
+			sample := float64(samples[i])
+			for _, filter := range filters {
+				sample = filter.process(sample)
+			}
+			stepPowers[i/stepFrames] += sample * sample / float64(stepFrames)
+		}
+	}
+
+	var blockPowers []float64
+	for start := 0; start+loudnessBlockSteps <= len(stepPowers); start++ {
+		power := 0.0
+		for _, stepPower := range stepPowers[start : start+loudnessBlockSteps] {
+			power += stepPower / loudnessBlockSteps
+		}
+		blockPowers = append(blockPowers, power)
+	}
+
+	gatedPower := func(gate float64) float64 {
+		total, count := 0.0, 0
+		for _, power := range blockPowers {
+			if powerToLUFS(power) > gate {
+				total += power
+				count++
+			}
+		}
+		if count == 0 {
+			return 0
+		}
+		return total / float64(count)
+	}
+	absolutelyGated := gatedPower(absoluteGateLUFS)
+	if absolutelyGated == 0 {
+		return math.Inf(-1)
+	}
+	relativeGate := math.Max(absoluteGateLUFS, powerToLUFS(absolutelyGated)+relativeGateLU)
+	return powerToLUFS(gatedPower(relativeGate))
+}
+
+func powerToLUFS(power float64) float64 {
+	return -0.691 + 10*math.Log10(power)
+}
+
+// Returns the two filters of the K-weighting curve at a sample rate - a high shelf modelling the head, and a high-pass - with
+// the coefficients worked out from the analogue filters so they fit any sample rate
+func kWeightingFilters(sampleRate int) []*biquad {
+	shelfK := math.Tan(math.Pi * 1681.974450955533 / float64(sampleRate))
+	shelfQ := 0.7071752369554196
+	shelfGain := math.Pow(10, 3.999843853973347/20)
+	shelfBoost := math.Pow(shelfGain, 0.4996667741545416)
+	shelfA0 := 1 + shelfK/shelfQ + shelfK*shelfK
+
+	highPassK := math.Tan(math.Pi * 38.13547087602444 / float64(sampleRate))
+	highPassQ := 0.5003270373238773
+	highPassA0 := 1 + highPassK/highPassQ + highPassK*highPassK
+
+	return []*biquad{
+		{
+			b0: (shelfGain + shelfBoost*shelfK/shelfQ + shelfK*shelfK) / shelfA0,
+			b1: 2 * (shelfK*shelfK - shelfGain) / shelfA0,
+			b2: (shelfGain - shelfBoost*shelfK/shelfQ + shelfK*shelfK) / shelfA0,
+			a1: 2 * (shelfK*shelfK - 1) / shelfA0,
+			a2: (1 - shelfK/shelfQ + shelfK*shelfK) / shelfA0,
+		},
+		{
+			b0: 1,
+			b1: -2,
+			b2: 1,
+			a1: 2 * (highPassK*highPassK - 1) / highPassA0,
+			a2: (1 - highPassK/highPassQ + highPassK*highPassK) / highPassA0,
+		},
+	}
+}
+
+// biquad is a two-pole, two-zero filter
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+	return y
+}
+
+// Returns the highest absolute value of the buffer's waveform, found by oversampling it
+func truePeak(b *Buffer) float64 {
+	phases := truePeakPhases()
+	peak := 0.0
+	for _, samples := range b.Channels {
+		for i := range samples {
+			peak = math.Max(peak, math.Abs(float64(samples[i])))
+			for _, taps := range phases {
+				value := 0.0
+				for t, tap := range taps {
+					if index := i + t - truePeakTaps/2 + 1; index >= 0 && index < len(samples) {
+						value += tap * float64(samples[index])
+					}
+				}
+				peak = math.Max(peak, math.Abs(value))
+			}
+		}
+	}
+	return peak
+}
+
+// Returns the taps of the interpolating filter for each point between two samples - taps[t] weighs the sample t-taps/2+1
+// places after the current one
+func truePeakPhases() [][]float64 {
+	var phases [][]float64
+	for phase := 1; phase < truePeakOversampling; phase++ {
+		offset := float64(phase) / truePeakOversampling
+		taps := make([]float64, truePeakTaps)
+		for t := range taps {
+			x := float64(t-truePeakTaps/2+1) - offset
+			// a Hann window over the taps either side of the point keeps the sinc from ringing
+			window := 0.5 + 0.5*math.Cos(math.Pi*x/(truePeakTaps/2))
+			taps[t] = window * sinc(x)
+		}
+		phases = append(phases, taps)
+	}
+	return phases
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// Turns the buffer down around every sample louder than limit, fading the gain down ahead of each peak and back up after it,
+// so no sample ends up louder than limit
+func limitPeaks(b *Buffer, limit float64) {
+	frames := b.Frames()
+	lookahead := int(limiterLookaheadSeconds*float64(b.SampleRate)) + 1
+	release := 1 - math.Exp(-1/(limiterReleaseSeconds*float64(b.SampleRate)))
+
+	// the gain each frame needs to be brought down to limit
+	needed := make([]float64, frames)
+	for i := range needed {
+		needed[i] = 1
+		for _, samples := range b.Channels {
+			if amplitude := math.Abs(float64(samples[i])); amplitude*needed[i] > limit {
+				needed[i] = limit / amplitude
+			}
+		}
+	}
+
+	// the lowest gain needed over the lookahead starting at each frame, rising back slowly after a peak - the frames still
+	// ahead are kept in a queue whose needed gains go up from front to back, so the front is always the lowest
+	held := make([]float64, frames)
+	var queue []int
+	next := 0
+	gain := 1.0
+	for i := 0; i < frames; i++ {
+		for ; next < frames && next < i+lookahead; next++ {
+			for len(queue) > 0 && needed[queue[len(queue)-1]] >= needed[next] {
+				queue = queue[:len(queue)-1]
+			}
+			queue = append(queue, next)
+		}
+		for queue[0] < i {
+			queue = queue[1:]
+		}
+		gain = math.Min(needed[queue[0]], gain+(1-gain)*release)
+		held[i] = gain
+	}
+
+	// averaging the held gain over the lookahead turns each drop into a ramp that still reaches the peak's gain by the peak -
+	// the frames before the start count as holding the first frame's gain
+	sum := float64(lookahead) * held[0]
+	for i := 0; i < frames; i++ {
+		sum += held[i]
+		if i >= lookahead {
+			sum -= held[i-lookahead]
+		} else {
+			sum -= held[0]
+		}
+		for _, samples := range b.Channels {
+			samples[i] *= float32(sum / float64(lookahead))
+		}
+	}
+}
+
+func applyGain(b *Buffer, gain float64) {
+	for _, samples := range b.Channels {
+		for i := range samples {
+			samples[i] *= float32(gain)
+		}
+	}
+}
+
+func decibelsToAmplitude(decibels float64) float64 {
+	return math.Pow(10, decibels/20)
+}
+
+func amplitudeToDecibels(amplitude float64) float64 {
+	return 20 * math.Log10(amplitude)
+}
@@ -0,0 +1,96 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+// Returns a buffer of seconds of a sine wave at frequency, with the given peak amplitude on each channel
+func sineBuffer(seconds float64, frequency float64, phase float64, amplitudes ...float64) *Buffer {
+	b := NewBuffer(48000, len(amplitudes), int(seconds*48000))
+	for c, amplitude := range amplitudes {
+		for i := range b.Channels[c] {
+			b.Channels[c][i] = float32(amplitude * math.Sin(2*math.Pi*frequency*float64(i)/48000+phase))
+		}
+	}
+	return b
+}
+
+func TestIntegratedLoudness(t *testing.T) {
+	tests := []struct {
+		name       string
+		amplitudes []float64
+		want       float64
+	}{
+		// the first of the EBU Tech 3341 test signals
+		{"1 kHz sine at -23 dBFS on both channels", []float64{decibelsToAmplitude(-23), decibelsToAmplitude(-23)}, -23},
+		{"1 kHz sine at -20 dBFS on one channel of the pair", []float64{decibelsToAmplitude(-20), 0}, -23},
+		{"silence", []float64{0, 0}, math.Inf(-1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := integratedLoudness(sineBuffer(20, 1000, 0, tt.amplitudes...))
+			if math.IsInf(tt.want, -1) {
+				if !math.IsInf(got, -1) {
+					t.Errorf("loudness = %v LUFS, want -Inf", got)
+				}
+				return
+			}
+			// EBU Tech 3341 allows a meter to be 0.1 LU out
+			if math.Abs(got-tt.want) > 0.1 {
+				t.Errorf("loudness = %v LUFS, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruePeak(t *testing.T) {
+	// a sine at a quarter of the sample rate, shifted an eighth of a cycle, has every sample at 0.707 of its peak - the peak
+	// itself falls between them
+	b := sineBuffer(1, 12000, math.Pi/4, 0.5)
+	if samplePeak := math.Abs(float64(b.Channels[0][0])); math.Abs(samplePeak-0.5/math.Sqrt2) > 1e-6 {
+		t.Fatalf("sample peak = %v, want %v", samplePeak, 0.5/math.Sqrt2)
+	}
+	if peak := truePeak(b); math.Abs(amplitudeToDecibels(peak/0.5)) > 0.2 {
+		t.Errorf("true peak = %v, want 0.5 to within 0.2 dB", peak)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	t.Run("quiet enough not to need limiting", func(t *testing.T) {
+		b := sineBuffer(5, 440, 0, 0.01, 0.01)
+		_, after := Normalize(b, -23, -1)
+		if math.Abs(after.Integrated+23) > 0.01 {
+			t.Errorf("loudness after = %v LUFS, want -23", after.Integrated)
+		}
+	})
+
+	t.Run("limited to the peak limit", func(t *testing.T) {
+		// short, loud bursts over a quiet sine need limiting to reach the target without going over the peak limit
+		b := sineBuffer(5, 440, 0, 0.05, 0.05)
+		for start := 0; start < b.Frames(); start += 48000 {
+			for i := start; i < start+480; i++ {
+				b.Channels[0][i] = float32(0.9 * math.Sin(2*math.Pi*3000*float64(i)/48000))
+			}
+		}
+		_, after := Normalize(b, -9, -1)
+		if after.TruePeak > -1+1e-6 {
+			t.Errorf("true peak after = %v dBTP, want at most -1", after.TruePeak)
+		}
+		// the peak Normalize reports is worked out from the gains it applied, so check it against the buffer itself
+		if measured := MeasureLoudness(b); measured.TruePeak > -1+1e-4 || math.Abs(measured.TruePeak-after.TruePeak) > 1e-4 {
+			t.Errorf("true peak of the normalized buffer = %v dBTP, reported as %v - want both at most -1", measured.TruePeak, after.TruePeak)
+		}
+		if after.Integrated < -10 {
+			t.Errorf("loudness after = %v LUFS, want close to -9", after.Integrated)
+		}
+	})
+
+	t.Run("silence", func(t *testing.T) {
+		b := NewBuffer(48000, 2, 48000)
+		before, after := Normalize(b, -23, -1)
+		if !math.IsInf(before.Integrated, -1) || !math.IsInf(after.Integrated, -1) {
+			t.Errorf("loudness of silence = %v and %v, want -Inf", before.Integrated, after.Integrated)
+		}
+	})
+}
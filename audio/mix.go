@@ -0,0 +1,53 @@
+package audio
+
+import (
+	"math"
+)
+
+// Part is a buffer to be mixed with a gain and pan of its own
+type Part struct {
+	Buffer *Buffer
+	// Gain the amplitude the buffer is scaled by
+	Gain float64
+	// Pan where a stereo buffer is moved to, from -1 (left) to 1 (right) - 0 leaves it where it is
+	Pan float64
+}
+
+// Mix adds parts of the same sample rate and number of channels together, as long as the longest of them - a part is panned
+// with the same constant-power law the synthesizer uses, so a centred part panned in the mix sounds as if it had been panned
+// when it was rendered
+func Mix(parts ...Part) *Buffer {
+	frames := 0
+	for _, p := range parts {
+		if p.Buffer.Frames() > frames {
+			frames = p.Buffer.Frames()
+		}
+	}
+	mix := NewBuffer(parts[0].Buffer.SampleRate, parts[0].Buffer.NumChannels(), frames)
+	for _, p := range parts {
+		gains := panGains(p.Pan, p.Buffer.NumChannels())
+		for c, samples := range p.Buffer.Channels {
+			gain := float32(p.Gain * gains[c])
+			mixed := mix.Channels[c]
+			for i, sample := range samples {
+				mixed[i] += sample * gain
+			}
+		}
+	}
+	return mix
+}
+
+// Returns the gain of each channel for a pan - only stereo buffers can be panned, and a pan of 0 leaves both sides as they are
+func panGains(pan float64, channels int) []float64 {
+	gains := make([]float64, channels)
+	for c := range gains {
+		gains[c] = 1
+	}
+	if channels != 2 || pan == 0 {
+		return gains
+	}
+	angle := (math.Max(-1, math.Min(1, pan)) + 1) * math.Pi / 4
+	gains[0] = math.Cos(angle) / math.Cos(math.Pi/4)
+	gains[1] = math.Sin(angle) / math.Sin(math.Pi/4)
+	return gains
+}
@@ -0,0 +1,77 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+// Returns a buffer whose channels each hold a constant value
+func constantBuffer(frames int, values ...float32) *Buffer {
+	b := NewBuffer(44100, len(values), frames)
+	for c, value := range values {
+		for i := range b.Channels[c] {
+			b.Channels[c][i] = value
+		}
+	}
+	return b
+}
+
+func TestMix(t *testing.T) {
+	tests := []struct {
+		name      string
+		parts     []Part
+		wantFrame []float64
+	}{
+		{
+			name:      "gains are applied before adding the parts",
+			parts:     []Part{{Buffer: constantBuffer(4, 0.5, 0.5), Gain: 0.5}, {Buffer: constantBuffer(4, 0.25, -0.25), Gain: 1}},
+			wantFrame: []float64{0.5, 0},
+		},
+		{
+			name:      "a part panned fully left only sounds on the left, at the level of both sides together",
+			parts:     []Part{{Buffer: constantBuffer(4, 0.25, 0.25), Gain: 1, Pan: -1}},
+			wantFrame: []float64{0.25 * math.Sqrt2, 0},
+		},
+		{
+			name:      "a part panned fully right only sounds on the right",
+			parts:     []Part{{Buffer: constantBuffer(4, 0.25, 0.25), Gain: 1, Pan: 1}},
+			wantFrame: []float64{0, 0.25 * math.Sqrt2},
+		},
+		{
+			name:      "pan is ignored for mono parts",
+			parts:     []Part{{Buffer: constantBuffer(4, 0.25), Gain: 2, Pan: 1}},
+			wantFrame: []float64{0.5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mix := Mix(tt.parts...)
+			for c, want := range tt.wantFrame {
+				if got := float64(mix.Channels[c][0]); math.Abs(got-want) > 1e-6 {
+					t.Errorf("channel %d = %v, want %v", c, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMixKeepsPower(t *testing.T) {
+	// however a centred part is panned, the power of the two sides adds up the same
+	for _, pan := range []float64{-1, -0.5, 0, 0.3, 1} {
+		mix := Mix(Part{Buffer: constantBuffer(1, 0.5, 0.5), Gain: 1, Pan: pan})
+		left, right := float64(mix.Channels[0][0]), float64(mix.Channels[1][0])
+		if power := left*left + right*right; math.Abs(power-0.5) > 1e-6 {
+			t.Errorf("pan %v gives a power of %v, want 0.5", pan, power)
+		}
+	}
+}
+
+func TestMixLength(t *testing.T) {
+	mix := Mix(Part{Buffer: constantBuffer(3, 1, 1), Gain: 1}, Part{Buffer: constantBuffer(5, 1, 1), Gain: 1})
+	if mix.Frames() != 5 {
+		t.Fatalf("got %d frames, want 5", mix.Frames())
+	}
+	if mix.Channels[0][2] != 2 || mix.Channels[0][4] != 1 {
+		t.Errorf("frames 2 and 4 = %v and %v, want 2 and 1 - the shorter part stops at its end", mix.Channels[0][2], mix.Channels[0][4])
+	}
+}
@@ -0,0 +1,162 @@
+package audio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+)
+
+// ErrNotWAV is returned when reading a file that isn't a RIFF WAVE file
+var ErrNotWAV = errors.New("audio: not a WAV file")
+
+// WAVE format tags for the sample formats that can be read
+const (
+	wavFormatPCM        = uint16(1)
+	wavFormatFloat      = uint16(3)
+	wavFormatExtensible = uint16(0xFFFE)
+)
+
+// WriteWAV writes the buffer as a 16-bit PCM WAV file - samples outside -1 to 1 are clipped
+func WriteWAV(w io.Writer, b *Buffer) error {
+	const bitsPerSample = 16
+	channels := b.NumChannels()
+	blockAlign := channels * bitsPerSample / 8
+	dataSize := b.Frames() * blockAlign
+
+	header := []interface{}{
+		[4]byte{'R', 'I', 'F', 'F'}, uint32(36 + dataSize), [4]byte{'W', 'A', 'V', 'E'},
+		[4]byte{'f', 'm', 't', ' '}, uint32(16), wavFormatPCM, uint16(channels), uint32(b.SampleRate),
+		uint32(b.SampleRate * blockAlign), uint16(blockAlign), uint16(bitsPerSample),
+		[4]byte{'d', 'a', 't', 'a'}, uint32(dataSize),
+	}
+	for _, field := range header {
+		if err := binary.Write(w, binary.LittleEndian, field); err != nil {
+			return err
+		}
+	}
+
+	frame := make([]byte, blockAlign)
+	for i := 0; i < b.Frames(); i++ {
+		for c, samples := range b.Channels {
+			sample := math.Max(-1, math.Min(1, float64(samples[i])))
+			binary.LittleEndian.PutUint16(frame[c*2:], uint16(int16(math.Round(sample*math.MaxInt16))))
+		}
+		if _, err := w.Write(frame); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteWAVFile writes the buffer to a 16-bit PCM WAV file at path
+func WriteWAVFile(path string, b *Buffer) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	if err := WriteWAV(writer, b); err != nil {
+		return err
+	}
+	return writer.Flush()
+}
+
+// ReadWAV reads a WAV file holding 8, 16, 24 or 32-bit PCM samples, or 32 or 64-bit float samples
+func ReadWAV(r io.Reader) (*Buffer, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, ErrNotWAV
+	}
+
+	var format, channels, bitsPerSample uint16
+	var sampleRate uint32
+	var samples []byte
+	for pos := 12; pos+8 <= len(data); {
+		chunkID := string(data[pos : pos+4])
+		chunkSize := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		chunkStart := pos + 8
+		chunkEnd := chunkStart + chunkSize
+		if chunkEnd > len(data) {
+			// files that were cut short still have whatever samples made it
+			chunkEnd = len(data)
+		}
+		switch chunkID {
+		case "fmt ":
+			if chunkEnd-chunkStart < 16 {
+				return nil, fmt.Errorf("audio: WAV format chunk is too short")
+			}
+			format = binary.LittleEndian.Uint16(data[chunkStart:])
+			channels = binary.LittleEndian.Uint16(data[chunkStart+2:])
+			sampleRate = binary.LittleEndian.Uint32(data[chunkStart+4:])
+			bitsPerSample = binary.LittleEndian.Uint16(data[chunkStart+14:])
+			// the real format of an extensible file is the first two bytes of its sub-format GUID
+			if format == wavFormatExtensible && chunkEnd-chunkStart >= 26 {
+				format = binary.LittleEndian.Uint16(data[chunkStart+24:])
+			}
+		case "data":
+			samples = data[chunkStart:chunkEnd]
+		}
+		// chunks are padded to an even length
+		pos = chunkStart + chunkSize + chunkSize%2
+	}
+	if channels == 0 || bitsPerSample == 0 {
+		return nil, fmt.Errorf("audio: WAV file has no format chunk")
+	}
+
+	decode, err := sampleDecoder(format, bitsPerSample)
+	if err != nil {
+		return nil, err
+	}
+	bytesPerSample := int(bitsPerSample) / 8
+	frames := len(samples) / (bytesPerSample * int(channels))
+	buffer := NewBuffer(int(sampleRate), int(channels), frames)
+	for i := 0; i < frames; i++ {
+		for c := 0; c < int(channels); c++ {
+			offset := (i*int(channels) + c) * bytesPerSample
+			buffer.Channels[c][i] = decode(samples[offset : offset+bytesPerSample])
+		}
+	}
+	return buffer, nil
+}
+
+// ReadWAVFile reads the WAV file at path
+func ReadWAVFile(path string) (*Buffer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadWAV(bufio.NewReader(file))
+}
+
+// Returns a function that turns one sample of the given format into a float between -1 and 1
+func sampleDecoder(format uint16, bitsPerSample uint16) (func([]byte) float32, error) {
+	switch {
+	case format == wavFormatPCM && bitsPerSample == 8:
+		// 8-bit samples are the only unsigned ones
+		return func(b []byte) float32 { return (float32(b[0]) - 128) / 128 }, nil
+	case format == wavFormatPCM && bitsPerSample == 16:
+		return func(b []byte) float32 { return float32(int16(binary.LittleEndian.Uint16(b))) / 32768 }, nil
+	case format == wavFormatPCM && bitsPerSample == 24:
+		return func(b []byte) float32 {
+			return float32(int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24)>>8) / 8388608
+		}, nil
+	case format == wavFormatPCM && bitsPerSample == 32:
+		return func(b []byte) float32 { return float32(float64(int32(binary.LittleEndian.Uint32(b))) / 2147483648) }, nil
+	case format == wavFormatFloat && bitsPerSample == 32:
+		return func(b []byte) float32 { return math.Float32frombits(binary.LittleEndian.Uint32(b)) }, nil
+	case format == wavFormatFloat && bitsPerSample == 64:
+		return func(b []byte) float32 { return float32(math.Float64frombits(binary.LittleEndian.Uint64(b))) }, nil
+	}
+	return nil, fmt.Errorf("audio: unsupported WAV sample format %d with %d bits per sample", format, bitsPerSample)
+}
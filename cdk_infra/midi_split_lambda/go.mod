@@ -4,8 +4,12 @@ go 1.16
 
 replace github.com/algoGuy/EasyMIDI => github.com/Try431/EasyMIDI v1.0.3
 
+// the lambda renders with the splitter's own render package
+replace github.com/Try431/MIDI-part-splitter => ../..
+
 require (
 	github.com/Try431/EasyMIDI v1.0.3
+	github.com/Try431/MIDI-part-splitter v0.0.0
 	github.com/aws/aws-lambda-go v1.27.1
 	github.com/aws/aws-sdk-go v1.42.23
 )
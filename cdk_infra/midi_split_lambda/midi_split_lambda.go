@@ -7,7 +7,6 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"sort"
 	"strconv"
@@ -17,6 +16,7 @@ import (
 
 	"github.com/Try431/EasyMIDI/smf"
 	"github.com/Try431/EasyMIDI/smfio"
+	"github.com/Try431/MIDI-part-splitter/render"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
@@ -58,7 +58,10 @@ var MP3OutputDirectory = "output/mp3s"
 // SilenceOutput when true, effectively stops all output to stdout
 var SilenceOutput = false
 
-// outputMIDIFilePaths is a slice of the full filepaths of the MIDI files created by writeNewMIDIFile() -- this slice will be accessed by the conversion bash script
+// AudioRenderer renders the output MIDI files to audio (default: fluidsynth and ffmpeg)
+var AudioRenderer render.Renderer = render.NewFluidSynth(render.DefaultConfig())
+
+// outputMIDIFilePaths is a slice of the full filepaths of the MIDI files created by writeNewMIDIFile() -- this slice will be accessed by AudioRenderer
 var (
 	outputMIDIFilePaths []string
 	filepathLock        sync.RWMutex
@@ -369,33 +372,12 @@ func uploadMIDIFilesToS3(filenames []string) error {
 	return nil
 }
 
-func runConversionScript(wg *sync.WaitGroup, filepath string) {
+// Renders one of the output MIDI files to audio in MP3OutputDirectory
+func renderAudioFile(wg *sync.WaitGroup, filepath string) {
 	defer wg.Done()
-	cmd := exec.Command("/bin/bash", "convert/convert_async.sh", filepath, MP3OutputDirectory, strconv.FormatBool(SilenceOutput))
-	// create a pipe for the output of the script
-	cmdReader, err := cmd.StdoutPipe()
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error creating StdoutPipe for Cmd", err)
-		return
-	}
-
-	scanner := bufio.NewScanner(cmdReader)
-	go func() {
-		for scanner.Scan() {
-			fmt.Printf("%s\n", scanner.Text())
-		}
-	}()
-
-	err = cmd.Start()
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error starting Cmd", err)
-		return
-	}
-
-	err = cmd.Wait()
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error waiting for Cmd", err)
-		return
+	printWrapper(fmt.Sprintf("Converting '%v' to an MP3 file in '%v'", filepath, MP3OutputDirectory))
+	if _, err := AudioRenderer.Render(render.Job{MIDIPath: filepath, LeadTrack: -1}, MP3OutputDirectory); err != nil {
+		fmt.Fprintln(os.Stderr, err)
 	}
 }
 
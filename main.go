@@ -6,10 +6,15 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 
+	"github.com/Try431/MIDI-part-splitter/audio"
 	"github.com/Try431/MIDI-part-splitter/midi"
+	"github.com/Try431/MIDI-part-splitter/render"
+	"github.com/Try431/MIDI-part-splitter/sf2"
 )
 
 // enabling line numbers in logging
@@ -20,17 +25,70 @@ func init() {
 func main() {
 	binaryName := os.Args[0]
 
+	// the sf2 subcommand lists the presets in a soundfont instead of splitting anything
+	if len(os.Args) > 1 && os.Args[1] == "sf2" {
+		listSoundFontPresets(os.Args[2:])
+		return
+	}
+
 	fileFlagPtr := flag.String("f", "", "Name of .mid file you wish to parse\n(e.g., '"+binaryName+" -f midi_file.mid')")
 	dirFlagPtr := flag.String("d", "", "Directory containing .mid files you wish to parse - will recursively search subdirectories\n(e.g., '"+binaryName+" -d ./dir/to/search/')")
+	gainCompFlagPtr := flag.Bool("gaincomp", false, "Scale each track's volume by how loud its notes are played compared to the other tracks, so the emphasis sounds the same whatever velocities the tracks were written with")
 	instFlagPtr := flag.Int("inst", 65, "Instrument number for emphasized track - see README for instrument list\n(e.g., '"+binaryName+" -f midi_file.mid -inst 22) ")
+	subSplitFlagPtr := flag.String("subsplit", "", "List of comma-separated tracks to split into an upper and a lower part, each given as name=chord (top note vs the notes below it) or name=note (split at that note number)\n(e.g., '"+binaryName+" -f midi_file.mid -subsplit Tenor_Bass=chord,Piano=60)")
 	volFlagPtr := flag.Int("vol", 40, "Volume of de-emphasized voice tracks - must be between 0 and 100\n(e.g., '"+binaryName+" -f midi_file.mid -vol 30)")
 	outFlagPtr := flag.String("o", "./"+midi.MIDIOutputDirectory+"/mp3s", "Directory where mp3 files will be stored\n(e.g., '"+binaryName+" -f midi_file.mid -o ./dir/to/store/mp3s)")
 	quietFlagPtr := flag.Bool("quiet", true, "Whether or not to silence standard output when running (will still allow stderr)")
 	listFlagPtr := flag.String("l", "", "List of comma-separated MIDI files to be parsed")
+	mergeFlagPtr := flag.String("merge", "", "List of comma-separated single-part MIDI files to merge into one score before parsing - each part is named after its file\n(e.g., '"+binaryName+" -merge soprano.mid,alto.mid,tenor.mid,bass.mid -mergename song)")
+	mergeNameFlagPtr := flag.String("mergename", "merged", "Name of the score created by -merge, used to name the output files")
+	bgInstFlagPtr := flag.Int("bginst", -1, "Instrument number for all de-emphasized tracks - by default each keeps its own instrument\n(e.g., '"+binaryName+" -f midi_file.mid -bginst 52)")
+	bgReverbFlagPtr := flag.Int("bgreverb", -1, "Reverb send of the de-emphasized tracks - must be between 0 and 127 (by default each keeps its own)")
+	bgChorusFlagPtr := flag.Int("bgchorus", -1, "Chorus send of the de-emphasized tracks - must be between 0 and 127 (by default each keeps its own)")
+	barsFlagPtr := flag.String("bars", "", "Range of bars to cut out of the song as an excerpt\n(e.g., '"+binaryName+" -f midi_file.mid -bars 40-56)")
+	chorusFlagPtr := flag.Int("chorus", -1, "Chorus send of the emphasized track - must be between 0 and 127 (by default it keeps its own)")
+	duckFlagPtr := flag.Bool("duck", false, "Only lower the de-emphasized voice tracks while the emphasized track is singing, bringing them back up during its rests")
+	duckRestVolFlagPtr := flag.Int("duckrestvol", 100, "Volume the de-emphasized voice tracks are brought back up to during the emphasized track's rests when using -duck - must be between 0 and 100")
+	entranceCueFlagPtr := flag.Int("entrancecue", 0, "Ping the emphasized track's entry note one beat before it comes back in after a rest of at least this many bars\n(e.g., '"+binaryName+" -f midi_file.mid -entrancecue 4)")
+	ladderFlagPtr := flag.String("ladder", "", "List of comma-separated volumes the emphasized track steps down through, writing one file per step - each must be between 0 and 100\n(e.g., '"+binaryName+" -f midi_file.mid -ladder 100,70,40,0)")
+	layerFlagPtr := flag.Int("layer", -1, "Instrument number to double the emphasized track with on a spare channel - use 128 to keep the track's original instrument\n(e.g., '"+binaryName+" -f midi_file.mid -inst 0 -layer 128)")
+	layerVolFlagPtr := flag.Int("layervol", 70, "Volume of the layer passed to -layer - must be between 0 and 100")
+	layerPrimaryVolFlagPtr := flag.Int("layerprimaryvol", 100, "Volume of the emphasized track itself when using -layer - must be between 0 and 100")
+	loopFlagPtr := flag.String("loop", "", "Range of bars to repeat in a loop practice file\n(e.g., '"+binaryName+" -f midi_file.mid -loop 40-56)")
+	loopCountFlagPtr := flag.Int("loopcount", 4, "Number of times the bars passed to -loop are played")
+	loopGapFlagPtr := flag.Int("loopgap", 0, "Number of beats of silence between repetitions of the bars passed to -loop")
+	loopCountInFlagPtr := flag.Bool("loopcountin", false, "Click on every beat between repetitions of the bars passed to -loop (a bar's worth of clicks unless -loopgap is set)")
+	reductionFlagPtr := flag.Bool("reduction", false, "Add a piano reduction of all voice tracks under every output, and write it as its own file")
+	reductionVolFlagPtr := flag.Int("reductionvol", 50, "Volume of the piano reduction from -reduction under the emphasized outputs - must be between 0 and 100")
+	reverbFlagPtr := flag.Int("reverb", -1, "Reverb send of the emphasized track - must be between 0 and 127 (by default it keeps its own)\n(e.g., '"+binaryName+" -f midi_file.mid -reverb 10 -bgreverb 70)")
+	rendererFlagPtr := flag.String("renderer", "fluidsynth", "Renderer used to create the audio files - 'fluidsynth' (mp3 files by default, needs fluidsynth installed) or 'native' (wav files by default, built in)")
+	formatFlagPtr := flag.String("format", "", "Format of the audio files - 'wav', 'flac', 'ogg' (or 'vorbis'), 'opus', 'm4a' (or 'aac') or 'mp3' - every format but wav needs ffmpeg installed (by default the renderer's own)\n(e.g., '"+binaryName+" -f midi_file.mid -format opus -bitrate 96)")
+	sampleRateFlagPtr := flag.Int("samplerate", 44100, "Sample rate of the audio files - must be between 8000 and 192000")
+	channelsFlagPtr := flag.Int("channels", 2, "Number of channels in the audio files - 1 (mono) or 2 (stereo)")
+	bitrateFlagPtr := flag.Int("bitrate", 0, "Bitrate (in kbit/s) of ogg, opus, m4a and mp3 files (by default 320 for mp3 and the encoder's own for the others)")
+	vbrFlagPtr := flag.Float64("vbr", -1, "VBR quality of ogg, m4a and mp3 files, on the encoder's own scale (e.g., 0-9 for mp3, where 0 is best) - used instead of -bitrate when set")
+	soundFontFlagPtr := flag.String("soundfont", "", "SoundFont (.sf2) file the audio files are rendered with - by default the one shipped in convert/\n(e.g., '"+binaryName+" -f midi_file.mid -soundfont GeneralUser_GS.sf2)")
+	leadSoundFontFlagPtr := flag.String("leadsoundfont", "", "SoundFont (.sf2) file the emphasized track is rendered with instead - the rest of the song still uses -soundfont\n(e.g., '"+binaryName+" -f midi_file.mid -leadsoundfont solo_voice.sf2)")
+	loudnessFlagPtr := flag.Float64("loudness", 0, "Integrated loudness (in LUFS) to normalize every audio file to, so all the parts of a song play at the same level - must be between -70 and -5 (by default files aren't normalized)\n(e.g., '"+binaryName+" -f midi_file.mid -loudness -16)")
+	truePeakFlagPtr := flag.Float64("truepeak", -1, "Highest true peak (in dBTP) a file normalized with -loudness may reach - louder peaks are limited, and it must be between -10 and 0")
+	trimFlagPtr := flag.Float64("trim", 0, "Level (in dBFS) below which the start and end of the audio files count as silence and are trimmed off, the same amount for every part of a song - must be between -120 and -20 (by default nothing is trimmed)\n(e.g., '"+binaryName+" -f midi_file.mid -trim -60 -pad 0.5)")
+	padFlagPtr := flag.Float64("pad", 0, "Seconds of silence added to the start and end of the audio files")
+	fadeInFlagPtr := flag.Float64("fadein", 0, "Length in seconds of the fade in at the start of the audio files")
+	fadeOutFlagPtr := flag.Float64("fadeout", 0, "Length in seconds of the fade out at the end of the audio files")
+	eqFlagPtr := flag.String("eq", "", "List of comma-separated EQ bands applied to the emphasized track's audio, each given as frequency:gain or frequency:gain:q (in Hz and dB, with a q of 1 unless given)\n(e.g., '"+binaryName+" -f midi_file.mid -eq 3000:4:1.5,250:-3:1)")
+	compFlagPtr := flag.String("comp", "", "Compressor applied to the emphasized track's audio, given as threshold:ratio or threshold:ratio:makeup (in dBFS and dB)\n(e.g., '"+binaryName+" -f midi_file.mid -comp -24:4:6)")
+	roomFlagPtr := flag.String("room", "", "Reverb applied to the emphasized track's audio, given as wet, wet:size or wet:size:damping (each between 0 and 1)\n(e.g., '"+binaryName+" -f midi_file.mid -room 0.2:0.6)")
+	bgEQFlagPtr := flag.String("bgeq", "", "List of comma-separated EQ bands applied to the de-emphasized tracks' audio, given like -eq")
+	bgCompFlagPtr := flag.String("bgcomp", "", "Compressor applied to the de-emphasized tracks' audio, given like -comp")
+	bgRoomFlagPtr := flag.String("bgroom", "", "Reverb applied to the de-emphasized tracks' audio, given like -room")
+	sectionsFlagPtr := flag.Bool("sections", false, "Write a separate set of files for each section of the song marked by Marker or Cue Point events")
+	octaveFlagPtr := flag.Int("octave", 0, "Double the emphasized track this many octaves up (positive) or down (negative)\n(e.g., '"+binaryName+" -f midi_file.mid -octave -1)")
+	octaveRangeFlagPtr := flag.String("octaverange", "21-108", "Range of notes the doubling from -octave may play - doubled notes outside it are left out")
+	pitchCueFlagPtr := flag.String("pitchcue", "", "Play each part's starting pitch before the music - 'all' (every part, in score order) or 'emphasized' (emphasized part only)\n(e.g., '"+binaryName+" -f midi_file.mid -pitchcue all)")
 
 	flag.Parse()
 
-	if !(isFlagPassed("f") || isFlagPassed("d") || isFlagPassed("l")) {
+	if !(isFlagPassed("f") || isFlagPassed("d") || isFlagPassed("l") || isFlagPassed("merge")) {
 		flag.Usage()
 		os.Exit(1)
 	}
@@ -47,10 +105,307 @@ func main() {
 		midi.MP3OutputDirectory = *outFlagPtr
 	}
 
+	if isFlagPassed("gaincomp") {
+		midi.GainCompensation = *gainCompFlagPtr
+	}
+
 	if isFlagPassed("inst") {
 		midi.EmphasizedInstrumentNum = uint8(*instFlagPtr)
 	}
 
+	if isFlagPassed("bginst") {
+		if *bgInstFlagPtr < 0 || *bgInstFlagPtr > 127 {
+			log.Fatal("Background instrument must be between 0 and 127")
+		}
+		midi.BackgroundInstrumentNum = *bgInstFlagPtr
+	}
+
+	if isFlagPassed("bgreverb") {
+		if *bgReverbFlagPtr < 0 || *bgReverbFlagPtr > 127 {
+			log.Fatal("Background reverb send must be between 0 and 127")
+		}
+		midi.BackgroundReverbSend = *bgReverbFlagPtr
+	}
+
+	if isFlagPassed("bgchorus") {
+		if *bgChorusFlagPtr < 0 || *bgChorusFlagPtr > 127 {
+			log.Fatal("Background chorus send must be between 0 and 127")
+		}
+		midi.BackgroundChorusSend = *bgChorusFlagPtr
+	}
+
+	if isFlagPassed("reverb") {
+		if *reverbFlagPtr < 0 || *reverbFlagPtr > 127 {
+			log.Fatal("Reverb send must be between 0 and 127")
+		}
+		midi.EmphasizedReverbSend = *reverbFlagPtr
+	}
+
+	if isFlagPassed("chorus") {
+		if *chorusFlagPtr < 0 || *chorusFlagPtr > 127 {
+			log.Fatal("Chorus send must be between 0 and 127")
+		}
+		midi.EmphasizedChorusSend = *chorusFlagPtr
+	}
+
+	if isFlagPassed("octave") {
+		if *octaveFlagPtr < -10 || *octaveFlagPtr > 10 {
+			log.Fatal("Octave doubling must be between -10 and 10 octaves")
+		}
+		midi.OctaveDoubling = *octaveFlagPtr
+	}
+
+	if isFlagPassed("octaverange") {
+		lowestNote, highestNote, err := parseNoteRange(*octaveRangeFlagPtr)
+		if err != nil {
+			log.Fatalf("Octave note range %v not accepted with error: %v", *octaveRangeFlagPtr, err)
+		}
+		midi.OctaveDoublingLowestNote = lowestNote
+		midi.OctaveDoublingHighestNote = highestNote
+	}
+
+	if isFlagPassed("pitchcue") {
+		if *pitchCueFlagPtr != midi.PitchCueAll && *pitchCueFlagPtr != midi.PitchCueEmphasized {
+			log.Fatal("Pitch cue mode " + *pitchCueFlagPtr + " not accepted - only '" + midi.PitchCueAll + "' or '" + midi.PitchCueEmphasized + "' allowed")
+		}
+		midi.PitchCueMode = *pitchCueFlagPtr
+	}
+
+	if isFlagPassed("bars") {
+		startBar, endBar, err := parseBarRange(*barsFlagPtr)
+		if err != nil {
+			log.Fatalf("Bar range %v not accepted with error: %v", *barsFlagPtr, err)
+		}
+		midi.ExcerptStartBar = startBar
+		midi.ExcerptEndBar = endBar
+	}
+
+	if isFlagPassed("duck") {
+		midi.DynamicDucking = *duckFlagPtr
+	}
+
+	if isFlagPassed("duckrestvol") {
+		if *duckRestVolFlagPtr < 0 || *duckRestVolFlagPtr > 100 {
+			log.Fatal("Duck rest volume must be between 0 and 100")
+		}
+		midi.DuckedRestVolume = uint8(*duckRestVolFlagPtr)
+	}
+
+	if isFlagPassed("entrancecue") {
+		if *entranceCueFlagPtr < 1 {
+			log.Fatal("Entrance cue rest length must be at least 1 bar")
+		}
+		midi.EntranceCueRestBars = *entranceCueFlagPtr
+	}
+
+	if isFlagPassed("ladder") {
+		for _, v := range strings.Split(*ladderFlagPtr, ",") {
+			volume, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil || volume < 0 || volume > 100 {
+				log.Fatal("Ladder volume " + v + " not accepted - volumes must be between 0 and 100")
+			}
+			midi.LadderVolumes = append(midi.LadderVolumes, uint8(volume))
+		}
+	}
+
+	if isFlagPassed("layer") {
+		if *layerFlagPtr < 0 || *layerFlagPtr > midi.LayerOriginalInstrument {
+			log.Fatal("Layer instrument must be between 0 and 128")
+		}
+		midi.LayerInstrumentNum = *layerFlagPtr
+	}
+
+	if isFlagPassed("layervol") {
+		if *layerVolFlagPtr < 0 || *layerVolFlagPtr > 100 {
+			log.Fatal("Layer volume must be between 0 and 100")
+		}
+		midi.LayerVolume = uint8(*layerVolFlagPtr)
+	}
+
+	if isFlagPassed("layerprimaryvol") {
+		if *layerPrimaryVolFlagPtr < 0 || *layerPrimaryVolFlagPtr > 100 {
+			log.Fatal("Layer primary volume must be between 0 and 100")
+		}
+		midi.LayerPrimaryVolume = uint8(*layerPrimaryVolFlagPtr)
+	}
+
+	if isFlagPassed("loop") {
+		startBar, endBar, err := parseBarRange(*loopFlagPtr)
+		if err != nil {
+			log.Fatalf("Loop bar range %v not accepted with error: %v", *loopFlagPtr, err)
+		}
+		midi.LoopStartBar = startBar
+		midi.LoopEndBar = endBar
+	}
+
+	if isFlagPassed("loopcount") {
+		if *loopCountFlagPtr < 1 {
+			log.Fatal("Loop count must be at least 1")
+		}
+		midi.LoopRepetitions = *loopCountFlagPtr
+	}
+
+	if isFlagPassed("loopgap") {
+		if *loopGapFlagPtr < 0 {
+			log.Fatal("Loop gap can't be negative")
+		}
+		midi.LoopGapBeats = *loopGapFlagPtr
+	}
+
+	if isFlagPassed("loopcountin") {
+		midi.LoopCountIn = *loopCountInFlagPtr
+	}
+
+	if isFlagPassed("reduction") {
+		midi.PianoReduction = *reductionFlagPtr
+	}
+
+	if isFlagPassed("reductionvol") {
+		if *reductionVolFlagPtr < 0 || *reductionVolFlagPtr > 100 {
+			log.Fatal("Reduction volume must be between 0 and 100")
+		}
+		midi.ReductionVolume = uint8(*reductionVolFlagPtr)
+	}
+
+	renderConfig := render.DefaultConfig()
+	if isFlagPassed("soundfont") {
+		renderConfig.SoundFont = filepath.Clean(*soundFontFlagPtr)
+		if !isSoundFontFile(renderConfig.SoundFont) {
+			log.Fatal("Soundfont " + renderConfig.SoundFont + " not accepted - only existing .sf2 files allowed")
+		}
+	}
+
+	if isFlagPassed("leadsoundfont") {
+		renderConfig.LeadSoundFont = filepath.Clean(*leadSoundFontFlagPtr)
+		if !isSoundFontFile(renderConfig.LeadSoundFont) {
+			log.Fatal("Soundfont " + renderConfig.LeadSoundFont + " not accepted - only existing .sf2 files allowed")
+		}
+	}
+
+	if isFlagPassed("format") {
+		format, err := render.ParseFormat(*formatFlagPtr)
+		if err != nil {
+			log.Fatal("Format must be one of 'wav', 'flac', 'ogg', 'opus', 'm4a' or 'mp3'")
+		}
+		renderConfig.Format = format
+	}
+
+	if isFlagPassed("samplerate") {
+		if *sampleRateFlagPtr < 8000 || *sampleRateFlagPtr > 192000 {
+			log.Fatal("Sample rate must be between 8000 and 192000")
+		}
+		renderConfig.SampleRate = *sampleRateFlagPtr
+	}
+
+	if isFlagPassed("channels") {
+		if *channelsFlagPtr != 1 && *channelsFlagPtr != 2 {
+			log.Fatal("Channels must be either 1 or 2")
+		}
+		renderConfig.Channels = *channelsFlagPtr
+	}
+
+	if isFlagPassed("bitrate") {
+		if *bitrateFlagPtr < 8 || *bitrateFlagPtr > 512 {
+			log.Fatal("Bitrate must be between 8 and 512")
+		}
+		renderConfig.Bitrate = *bitrateFlagPtr
+	}
+
+	if isFlagPassed("vbr") {
+		if *vbrFlagPtr < 0 {
+			log.Fatal("VBR quality must not be negative")
+		}
+		renderConfig.Quality = *vbrFlagPtr
+	}
+
+	if isFlagPassed("loudness") {
+		if *loudnessFlagPtr < -70 || *loudnessFlagPtr > -5 {
+			log.Fatal("Loudness must be between -70 and -5")
+		}
+		renderConfig.LoudnessTarget = *loudnessFlagPtr
+	}
+
+	if isFlagPassed("truepeak") {
+		if *truePeakFlagPtr < -10 || *truePeakFlagPtr > 0 {
+			log.Fatal("True peak must be between -10 and 0")
+		}
+		renderConfig.TruePeakLimit = *truePeakFlagPtr
+	}
+
+	if isFlagPassed("trim") {
+		if *trimFlagPtr < -120 || *trimFlagPtr > -20 {
+			log.Fatal("Trim level must be between -120 and -20")
+		}
+		renderConfig.TrimThreshold = *trimFlagPtr
+	}
+
+	if isFlagPassed("pad") {
+		if *padFlagPtr < 0 {
+			log.Fatal("Padding must not be negative")
+		}
+		renderConfig.Padding = *padFlagPtr
+	}
+
+	if isFlagPassed("fadein") {
+		if *fadeInFlagPtr < 0 {
+			log.Fatal("Fade in length must not be negative")
+		}
+		renderConfig.FadeIn = *fadeInFlagPtr
+	}
+
+	if isFlagPassed("fadeout") {
+		if *fadeOutFlagPtr < 0 {
+			log.Fatal("Fade out length must not be negative")
+		}
+		renderConfig.FadeOut = *fadeOutFlagPtr
+	}
+
+	renderConfig.EmphasizedEffects = parseEffects(*eqFlagPtr, *compFlagPtr, *roomFlagPtr)
+	renderConfig.BackgroundEffects = parseEffects(*bgEQFlagPtr, *bgCompFlagPtr, *bgRoomFlagPtr)
+
+	// each renderer writes its own format unless another one is asked for
+	outputFormat := renderConfig.Format
+	switch *rendererFlagPtr {
+	case "fluidsynth":
+		midi.AudioRenderer = render.NewFluidSynth(renderConfig)
+		if outputFormat == "" {
+			outputFormat = render.FormatMP3
+		}
+	case "native":
+		midi.AudioRenderer = render.NewNative(renderConfig)
+		if outputFormat == "" {
+			outputFormat = render.FormatWAV
+		}
+	default:
+		log.Fatal("Renderer must be either 'fluidsynth' or 'native'")
+	}
+	// the native synthesizer doesn't have reverb or chorus units for the sends to feed
+	if *rendererFlagPtr == "native" && (isFlagPassed("reverb") || isFlagPassed("bgreverb") || isFlagPassed("chorus") || isFlagPassed("bgchorus")) {
+		fmt.Fprintln(os.Stderr, "The native renderer doesn't play reverb or chorus sends - use -room and -bgroom to add reverb instead")
+	}
+
+	if isFlagPassed("sections") {
+		midi.SplitBySections = *sectionsFlagPtr
+	}
+
+	if isFlagPassed("subsplit") {
+		for _, split := range strings.Split(*subSplitFlagPtr, ",") {
+			nameAndPoint := strings.SplitN(split, "=", 2)
+			if len(nameAndPoint) != 2 {
+				log.Fatal("Sub-split " + split + " not accepted - expected name=chord or name=note")
+			}
+			if nameAndPoint[1] == "chord" {
+				midi.SubSplitTracks[nameAndPoint[0]] = midi.SubSplitByChordPosition
+				continue
+			}
+			note, err := strconv.Atoi(nameAndPoint[1])
+			if err != nil || note < 0 || note > 127 {
+				log.Fatal("Sub-split " + split + " not accepted - split notes must be between 0 and 127")
+			}
+			midi.SubSplitTracks[nameAndPoint[0]] = note
+		}
+	}
+
 	var filePaths []string
 
 	if isFlagPassed("f") {
@@ -77,6 +432,32 @@ func main() {
 		}
 	}
 
+	var mergeFilePaths []string
+	if isFlagPassed("merge") {
+		files := strings.Split(*mergeFlagPtr, ",")
+		for _, f := range files {
+			filePath := filepath.Clean(f)
+			if !isMIDIFile(filePath) {
+				log.Fatal("File " + filePath + " not accepted - only MIDI files allowed")
+			}
+			mergeFilePaths = append(mergeFilePaths, filePath)
+		}
+	}
+
+	// a preset the soundfonts don't have would play silence, so check the instruments before splitting - only the presets are
+	// read, as the sample data isn't needed to look them up
+	if soundFont, err := sf2.OpenPresets(renderConfig.SoundFont); err == nil {
+		var leadSoundFont *sf2.SoundFont
+		if renderConfig.LeadSoundFont != "" {
+			if leadSoundFont, err = sf2.OpenPresets(renderConfig.LeadSoundFont); err != nil {
+				fmt.Fprintln(os.Stderr, "Unable to check the emphasized instrument against the lead soundfont:", err)
+			}
+		}
+		midi.CheckInstruments(soundFont, leadSoundFont)
+	} else {
+		fmt.Fprintln(os.Stderr, "Unable to check the instruments against the soundfont:", err)
+	}
+
 	fmt.Println("Starting split & conversion process...")
 	var wg sync.WaitGroup
 	wg.Add(len(filePaths))
@@ -84,8 +465,38 @@ func main() {
 		fPath := filePaths[i]
 		midi.SplitParts(&wg, fPath)
 	}
+	if len(mergeFilePaths) > 0 {
+		wg.Add(1)
+		midi.MergeAndSplitParts(&wg, mergeFilePaths, *mergeNameFlagPtr)
+	}
 	wg.Wait()
-	fmt.Println("All done! 😄 Enjoy your MP3 files!")
+	fmt.Printf("All done! 😄 Enjoy your %v files!\n", strings.ToUpper(string(outputFormat)))
+}
+
+// Prints the bank, program and name of every preset in a soundfont - the soundfont shipped with the splitter is used
+// unless another one is given
+func listSoundFontPresets(args []string) {
+	soundFontPath := render.DefaultSoundFont()
+	if len(args) > 0 {
+		soundFontPath = args[0]
+	}
+	soundFont, err := sf2.OpenPresets(soundFontPath)
+	if err != nil {
+		log.Fatalf("Failed to read soundfont %v with error: %v", soundFontPath, err)
+	}
+
+	presets := append([]*sf2.Preset{}, soundFont.Presets...)
+	sort.Slice(presets, func(i, j int) bool {
+		if presets[i].Bank != presets[j].Bank {
+			return presets[i].Bank < presets[j].Bank
+		}
+		return presets[i].Program < presets[j].Program
+	})
+	fmt.Printf("%v (%v)\n", soundFont.Name, soundFontPath)
+	fmt.Printf("%-6v %-8v %v\n", "Bank", "Program", "Name")
+	for _, preset := range presets {
+		fmt.Printf("%-6d %-8d %v\n", preset.Bank, preset.Program, preset.Name)
+	}
 }
 
 // Determines if a flag was passed in
@@ -99,11 +510,112 @@ func isFlagPassed(name string) bool {
 	return found
 }
 
+// Parses a bar range in the form "start-end" (e.g., "40-56")
+func parseBarRange(barRange string) (int, int, error) {
+	bounds := strings.Split(barRange, "-")
+	if len(bounds) != 2 {
+		return 0, 0, fmt.Errorf("expected a range in the form start-end")
+	}
+	startBar, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+	if err != nil {
+		return 0, 0, err
+	}
+	endBar, err := strconv.Atoi(strings.TrimSpace(bounds[1]))
+	if err != nil {
+		return 0, 0, err
+	}
+	if startBar < 1 || endBar < startBar {
+		return 0, 0, fmt.Errorf("bars must start at 1 or later and end after they start")
+	}
+	return startBar, endBar, nil
+}
+
+// Parses a note range in the form "lowest-highest" (e.g., "36-84")
+func parseNoteRange(noteRange string) (uint8, uint8, error) {
+	bounds := strings.Split(noteRange, "-")
+	if len(bounds) != 2 {
+		return 0, 0, fmt.Errorf("expected a range in the form lowest-highest")
+	}
+	lowestNote, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+	if err != nil {
+		return 0, 0, err
+	}
+	highestNote, err := strconv.Atoi(strings.TrimSpace(bounds[1]))
+	if err != nil {
+		return 0, 0, err
+	}
+	if lowestNote < 0 || highestNote > 127 || highestNote < lowestNote {
+		return 0, 0, fmt.Errorf("notes must be between 0 and 127 and the highest can't be below the lowest")
+	}
+	return uint8(lowestNote), uint8(highestNote), nil
+}
+
 func isMIDIFile(path string) bool {
 	extension := filepath.Ext(path)
 	return (extension == ".mid" || extension == ".midi")
 }
 
+// Builds the chain of effects given by the EQ, compressor and reverb flags of a role - they're applied in that order, and an
+// empty flag leaves its effect out
+func parseEffects(eq string, comp string, room string) []audio.Effect {
+	var effects []audio.Effect
+	if eq != "" {
+		for _, band := range strings.Split(eq, ",") {
+			values := append(parseEffectValues(band, 2, 3), 1)
+			if values[0] <= 0 || values[2] <= 0 {
+				log.Fatal("EQ band " + band + " not accepted - the frequency and q must be above 0")
+			}
+			effects = append(effects, audio.EQBand{Frequency: values[0], Gain: values[1], Q: values[2]})
+		}
+	}
+	if comp != "" {
+		values := parseEffectValues(comp, 2, 3)
+		if values[0] > 0 || values[1] < 1 {
+			log.Fatal("Compressor " + comp + " not accepted - the threshold must be at most 0 and the ratio at least 1")
+		}
+		compressor := audio.Compressor{Threshold: values[0], Ratio: values[1]}
+		if len(values) > 2 {
+			compressor.MakeupGain = values[2]
+		}
+		effects = append(effects, compressor)
+	}
+	if room != "" {
+		values := append(parseEffectValues(room, 1, 3), 0.5, 0.5)
+		for _, value := range values {
+			if value < 0 || value > 1 {
+				log.Fatal("Reverb " + room + " not accepted - each value must be between 0 and 1")
+			}
+		}
+		effects = append(effects, audio.Reverb{Wet: values[0], RoomSize: values[1], Damping: values[2]})
+	}
+	return effects
+}
+
+// Parses the colon-separated numbers of an effect setting, which must have between min and max of them
+func parseEffectValues(setting string, min int, max int) []float64 {
+	fields := strings.Split(setting, ":")
+	if len(fields) < min || len(fields) > max {
+		log.Fatalf("Effect setting %v not accepted - expected between %d and %d colon-separated numbers", setting, min, max)
+	}
+	var values []float64
+	for _, field := range fields {
+		value, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			log.Fatalf("Effect setting %v not accepted - %v is not a number", setting, field)
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+// Determines if a path is an existing .sf2 file
+func isSoundFontFile(path string) bool {
+	if info, err := os.Stat(path); err != nil || info.IsDir() {
+		return false
+	}
+	return strings.EqualFold(filepath.Ext(path), ".sf2")
+}
+
 // Walks through directory recursively and grabs all MIDI files
 func grabFilesInDir(dirPath string) []string {
 	var files []string
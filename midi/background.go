@@ -0,0 +1,37 @@
+package midi
+
+import (
+	"github.com/Try431/EasyMIDI/smf"
+)
+
+// BackgroundInstrumentNum the number corresponding to the instrument played by all non-emphasized tracks, e.g. 52 for choir aahs
+// or 0 for piano (default -1: non-emphasized tracks keep their own instruments)
+var BackgroundInstrumentNum = -1
+
+// Returns the tracks with their program change MIDI event set to BackgroundInstrumentNum - header tracks and percussion tracks
+// (whose program picks a drum kit) are left as they are
+func tracksWithBackgroundInstrument(tracks []*smf.Track) []*smf.Track {
+	var backgroundTracks []*smf.Track
+	for _, track := range tracks {
+		isHeader, channel := isHeaderTrackAndGetTrackChannel(track)
+		if isHeader || channel == percussionChannel {
+			backgroundTracks = append(backgroundTracks, track)
+			continue
+		}
+		backgroundTracks = append(backgroundTracks, setTrackProgram(track, uint8(BackgroundInstrumentNum)))
+	}
+	return backgroundTracks
+}
+
+// Returns a new track with its program change MIDI event set to instrumentNum - tracks without one are returned as is
+func setTrackProgram(track *smf.Track, instrumentNum uint8) *smf.Track {
+	eventPos := uint32(0)
+	iter := track.GetIterator()
+	for iter.MoveNext() {
+		if iter.GetValue().GetStatus() == programChangeStatusNum {
+			return createNewTrack(track, eventPos, newChannelEvent(programChangeStatusNum, iter.GetValue().GetChannel(), instrumentNum, 0))
+		}
+		eventPos++
+	}
+	return track
+}
@@ -0,0 +1,27 @@
+package midi
+
+import (
+	"github.com/Try431/EasyMIDI/smf"
+)
+
+// Returns the channels that no MIDI_EVENT in any of the tracks uses, lowest first - the percussion channel is never returned
+func unusedChannels(tracks []*smf.Track) []uint8 {
+	usedChannels := make(map[uint8]bool)
+	usedChannels[percussionChannel] = true
+	for _, track := range tracks {
+		iter := track.GetIterator()
+		for iter.MoveNext() {
+			if smf.CheckMIDIStatus(iter.GetValue().GetStatus()) {
+				usedChannels[iter.GetValue().GetChannel()] = true
+			}
+		}
+	}
+
+	var channels []uint8
+	for channel := uint8(0); channel <= smf.MaxChannelNumber; channel++ {
+		if !usedChannels[channel] {
+			channels = append(channels, channel)
+		}
+	}
+	return channels
+}
@@ -0,0 +1,110 @@
+package midi
+
+import (
+	"github.com/Try431/EasyMIDI/smf"
+)
+
+// DynamicDucking when true, the non-emphasized tracks are only lowered while the emphasized track has notes sounding,
+// and brought back up to DuckedRestVolume during its rests
+var DynamicDucking = false
+
+// DuckedRestVolume the volume the non-emphasized tracks are brought back up to while the emphasized track rests (default 100)
+var DuckedRestVolume = uint8(100)
+
+// 0x0B is the code for a control change number for a channel's expression, which scales the channel's main volume
+const expressionControllerNum = uint8(0x0B)
+
+// rests in the emphasized track shorter than this aren't worth bringing the other tracks back up for
+const duckMinimumRest = uint32(outputTicksPerQuarter)
+
+// how long it takes to bring the other tracks down or back up
+const duckRampLength = uint32(outputTicksPerQuarter) / 4
+
+// number of expression events written for each ramp
+const duckRampSteps = uint32(8)
+
+// phrase is a stretch of ticks during which a track has at least one note sounding
+type phrase struct {
+	start uint32
+	end   uint32
+}
+
+// Finds the phrases in a track - phrases separated by less than duckMinimumRest are merged together
+func soundingPhrases(track *smf.Track) []phrase {
+	var phrases []phrase
+	soundingNotes := 0
+	for _, te := range absoluteEvents(track) {
+		if isNoteOn(te.event) {
+			if soundingNotes == 0 {
+				if len(phrases) > 0 && te.tick-phrases[len(phrases)-1].end < duckMinimumRest {
+					// carry on with the previous phrase
+					phrases[len(phrases)-1].end = te.tick
+				} else {
+					phrases = append(phrases, phrase{start: te.tick, end: te.tick})
+				}
+			}
+			soundingNotes++
+		} else if isNoteOff(te.event) && soundingNotes > 0 {
+			soundingNotes--
+			if soundingNotes == 0 {
+				phrases[len(phrases)-1].end = te.tick
+			}
+		}
+	}
+	return phrases
+}
+
+// Returns a copy of a non-emphasized track that's set to restVolume (DuckedRestVolume, scaled by the track's gain when gain
+// compensation is on), with expression automation that brings it down to duckedVolume (NonEmphasizedTrackVolume, scaled the
+// same way) during each of the emphasized track's phrases. Any expression events already in the track are replaced.
+func duckTrack(track *smf.Track, phrases []phrase, restVolume uint8, duckedVolume uint8) *smf.Track {
+	isHeader, channel := isHeaderTrackAndGetTrackChannel(track)
+	if isHeader || restVolume <= duckedVolume {
+		return track
+	}
+
+	// the channel's loudness follows the product of its volume and expression, so scaling expression by the ratio of the
+	// two volumes sounds the same as setting the volume to duckedVolume
+	duckedExpression := uint8(uint32(smf.MaxDataByteSize) * uint32(duckedVolume) / uint32(restVolume))
+	restExpression := smf.MaxDataByteSize
+
+	var duckedEvents []timedEvent
+	for _, te := range absoluteEvents(setTrackVolume(track, restVolume)) {
+		if te.event.GetStatus() == controlChangeStatusNum && te.event.GetData()[0] == expressionControllerNum {
+			continue
+		}
+		duckedEvents = append(duckedEvents, te)
+	}
+
+	if len(phrases) == 0 || phrases[0].start > 0 {
+		duckedEvents = append(duckedEvents, timedEvent{tick: 0, event: newChannelEvent(controlChangeStatusNum, channel, expressionControllerNum, restExpression)})
+	}
+	previousEnd := uint32(0)
+	for i, p := range phrases {
+		// bring the track down so it's fully ducked by the time the phrase starts
+		rampStart := previousEnd
+		if p.start > duckRampLength && p.start-duckRampLength > previousEnd {
+			rampStart = p.start - duckRampLength
+		}
+		if i == 0 && p.start == 0 {
+			duckedEvents = append(duckedEvents, timedEvent{tick: 0, event: newChannelEvent(controlChangeStatusNum, channel, expressionControllerNum, duckedExpression)})
+		} else {
+			duckedEvents = append(duckedEvents, expressionRamp(channel, rampStart, p.start, restExpression, duckedExpression)...)
+		}
+		// and bring it back up once the phrase has finished
+		duckedEvents = append(duckedEvents, expressionRamp(channel, p.end, p.end+duckRampLength, duckedExpression, restExpression)...)
+		previousEnd = p.end + duckRampLength
+	}
+	return trackFromAbsoluteEvents(duckedEvents)
+}
+
+// Returns expression events that move linearly from one value to another between the start and end ticks
+func expressionRamp(channel uint8, start uint32, end uint32, from uint8, to uint8) []timedEvent {
+	var rampEvents []timedEvent
+	for step := uint32(1); step <= duckRampSteps; step++ {
+		tick := start + (end-start)*step/duckRampSteps
+		value := int(from) + (int(to)-int(from))*int(step)/int(duckRampSteps)
+		rampEvents = append(rampEvents, timedEvent{tick: tick, event: newChannelEvent(controlChangeStatusNum, channel, expressionControllerNum, uint8(value))})
+	}
+	return rampEvents
+}
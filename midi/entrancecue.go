@@ -0,0 +1,63 @@
+package midi
+
+import (
+	"github.com/Try431/EasyMIDI/smf"
+)
+
+// EntranceCueRestBars when greater than 0, a cue of the entry note is played one beat before the emphasized track comes back in after
+// a rest of at least this many bars (default 0: no entrance cues)
+var EntranceCueRestBars = 0
+
+// EntranceCueInstrumentNum the number corresponding to the instrument the entrance cues are played on (default 9: glockenspiel)
+var EntranceCueInstrumentNum = uint8(9)
+
+// velocity of the entrance cue notes - soft enough to not be mistaken for part of the music
+const entranceCueVelocity = uint8(60)
+
+// Creates a track on a spare channel that pings the emphasized track's entry note one beat before each entry that follows a long rest -
+// returns false if the emphasized track has no such entries or there's no spare channel to play the cues on
+func createEntranceCueTrack(emphasizedTrack *smf.Track, tracks []*smf.Track, timeSignatures timeSignatureMap) (*smf.Track, bool) {
+	// the entries that follow a long enough rest, counting the time before the first entry as a rest too
+	var entries []uint32
+	restStart := uint32(0)
+	for _, p := range soundingPhrases(emphasizedTrack) {
+		if p.start-restStart >= uint32(EntranceCueRestBars)*timeSignatures.barLengthAt(restStart) && p.start >= timeSignatures.beatLengthAt(p.start) {
+			entries = append(entries, p.start)
+		}
+		restStart = p.end
+	}
+	if len(entries) == 0 {
+		return nil, false
+	}
+
+	spareChannels := unusedChannels(tracks)
+	if len(spareChannels) == 0 {
+		printWrapper("No spare MIDI channel left for entrance cues - skipping them")
+		return nil, false
+	}
+	channel := spareChannels[0]
+
+	cueEvents := []timedEvent{
+		{tick: 0, event: newChannelEvent(programChangeStatusNum, channel, EntranceCueInstrumentNum, 0)},
+		{tick: 0, event: newChannelEvent(controlChangeStatusNum, channel, volumeControllerNum, EmphasizedTrackVolume)},
+	}
+	for _, entry := range entries {
+		beat := timeSignatures.beatLengthAt(entry)
+		pitch := entryNote(emphasizedTrack, entry)
+		cueEvents = append(cueEvents,
+			timedEvent{tick: entry - beat, event: newChannelEvent(smf.NoteOnStatus, channel, pitch, entranceCueVelocity)},
+			timedEvent{tick: entry - beat/2, event: newChannelEvent(smf.NoteOffStatus, channel, pitch, 0)},
+		)
+	}
+	return trackFromAbsoluteEvents(cueEvents), true
+}
+
+// Returns the pitch of the first note that starts at tick
+func entryNote(track *smf.Track, tick uint32) uint8 {
+	for _, te := range absoluteEvents(track) {
+		if te.tick == tick && isNoteOn(te.event) {
+			return te.event.GetData()[0]
+		}
+	}
+	return 0
+}
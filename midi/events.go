@@ -0,0 +1,149 @@
+package midi
+
+import (
+	"log"
+	"sort"
+
+	"github.com/Try431/EasyMIDI/smf"
+)
+
+// outputTicksPerQuarter is the division written to every output MIDI file
+const outputTicksPerQuarter = uint16(960)
+
+// MIDI channel 10 (9 when counting from 0) is reserved for percussion by General MIDI
+const percussionChannel = uint8(9)
+
+// timedEvent is a track event paired with its absolute position (in ticks) from the start of the track
+type timedEvent struct {
+	tick  uint32
+	event smf.Event
+}
+
+// Converts the delta times of a track into absolute ticks
+func absoluteEvents(track *smf.Track) []timedEvent {
+	var events []timedEvent
+	tick := uint32(0)
+	for _, e := range track.GetAllEvents() {
+		tick += e.GetDTime()
+		events = append(events, timedEvent{tick: tick, event: e})
+	}
+	return events
+}
+
+// Returns the tick of the last event in any of the tracks
+func songEndTick(tracks []*smf.Track) uint32 {
+	songEnd := uint32(0)
+	for _, track := range tracks {
+		for _, te := range absoluteEvents(track) {
+			if te.tick > songEnd {
+				songEnd = te.tick
+			}
+		}
+	}
+	return songEnd
+}
+
+// Builds a new smf.Track from absolutely-timed events - events are copied because tracks share event pointers,
+// and the End of Track event is always moved to the very end
+func trackFromAbsoluteEvents(events []timedEvent) *smf.Track {
+	sorted := make([]timedEvent, 0, len(events))
+	lastTick := uint32(0)
+	for _, te := range events {
+		if te.tick > lastTick {
+			lastTick = te.tick
+		}
+		if isEndOfTrackEvent(te.event) {
+			continue
+		}
+		sorted = append(sorted, te)
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].tick < sorted[j].tick })
+
+	var trackEvents []smf.Event
+	prevTick := uint32(0)
+	for _, te := range sorted {
+		trackEvents = append(trackEvents, copyEvent(te.event, te.tick-prevTick))
+		prevTick = te.tick
+	}
+	endOfTrack, err := smf.NewMetaEvent(lastTick-prevTick, smf.MetaEndOfTrack, []byte{})
+	if err != nil {
+		log.Fatalf("Failed to create End of Track event with error: %v", err)
+	}
+	trackEvents = append(trackEvents, endOfTrack)
+
+	updatedTrack, err := smf.TrackFromArray(trackEvents)
+	if err != nil {
+		log.Fatalf("Failed to create new track from event list with error: %v", err)
+	}
+	return updatedTrack
+}
+
+// Returns a copy of an event with a new delta time
+func copyEvent(e smf.Event, deltaTime uint32) smf.Event {
+	var newEvent smf.Event
+	var err error
+	switch event := e.(type) {
+	case *smf.MIDIEvent:
+		data := event.GetData()
+		secondDataByte := uint8(0)
+		if len(data) > 1 {
+			secondDataByte = data[1]
+		}
+		newEvent, err = smf.NewMIDIEvent(deltaTime, event.GetStatus(), event.GetChannel(), data[0], secondDataByte)
+	case *smf.MetaEvent:
+		newEvent, err = smf.NewMetaEvent(deltaTime, event.GetMetaType(), event.GetData())
+	case *smf.SysexEvent:
+		newEvent, err = smf.NewSysexEvent(deltaTime, event.GetStatus(), event.GetData())
+	default:
+		log.Fatalf("Failed to copy unsupported event %v", e)
+	}
+	if err != nil {
+		log.Fatalf("Failed to copy event %v with error: %v", e, err)
+	}
+	return newEvent
+}
+
+// Creates a new MIDI_EVENT with no delta time, to be positioned with an absolute tick
+func newChannelEvent(status uint8, channel uint8, firstDataByte uint8, secondDataByte uint8) *smf.MIDIEvent {
+	event, err := smf.NewMIDIEvent(0, status, channel, firstDataByte, secondDataByte)
+	if err != nil {
+		log.Fatalf("Failed to create new MIDI event with error: %v", err)
+	}
+	return event
+}
+
+func isEndOfTrackEvent(e smf.Event) bool {
+	return e.GetStatus() == smf.MetaStatus && e.GetMetaType() == smf.MetaEndOfTrack
+}
+
+// Note-on events with a velocity of 0 are treated as note-offs by every MIDI device
+func isNoteOn(e smf.Event) bool {
+	return e.GetStatus() == smf.NoteOnStatus && e.GetData()[1] > 0
+}
+
+func isNoteOff(e smf.Event) bool {
+	return e.GetStatus() == smf.NoteOffStatus || (e.GetStatus() == smf.NoteOnStatus && e.GetData()[1] == 0)
+}
+
+// Returns the pitch and channel of the first note that sounds in the track
+func firstSoundingNote(track *smf.Track) (uint8, uint8, bool) {
+	iter := track.GetIterator()
+	for iter.MoveNext() {
+		if isNoteOn(iter.GetValue()) {
+			return iter.GetValue().GetData()[0], iter.GetValue().GetChannel(), true
+		}
+	}
+	return 0, 0, false
+}
+
+// Returns a copy of the track with everything after the initial setup delayed by offset ticks -
+// meta, program and controller events at tick 0 stay put so the delayed music starts with the right setup
+func delayTrack(track *smf.Track, offset uint32) []timedEvent {
+	events := absoluteEvents(track)
+	for i, te := range events {
+		if te.tick > 0 || isNoteOn(te.event) || isNoteOff(te.event) {
+			events[i].tick += offset
+		}
+	}
+	return events
+}
@@ -0,0 +1,78 @@
+package midi
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Try431/EasyMIDI/smf"
+)
+
+// Returns a note-on and a note-off event for a note on a channel, from start for length ticks
+func testNote(channel uint8, key uint8, velocity uint8, start uint32, length uint32) []timedEvent {
+	return []timedEvent{
+		{tick: start, event: newChannelEvent(smf.NoteOnStatus, channel, key, velocity)},
+		{tick: start + length, event: newChannelEvent(smf.NoteOffStatus, channel, key, 0)},
+	}
+}
+
+// Returns a track holding the events, along with a note at each of the velocities on a channel, one after the other a beat apart
+func testTrack(channel uint8, velocities []uint8, events ...timedEvent) *smf.Track {
+	for i, velocity := range velocities {
+		events = append(events, testNote(channel, 60, velocity, uint32(i)*uint32(outputTicksPerQuarter), uint32(outputTicksPerQuarter))...)
+	}
+	return trackFromAbsoluteEvents(events)
+}
+
+// Returns a meta event, to be positioned with an absolute tick
+func testMetaEvent(t *testing.T, metaType uint8, data []byte) smf.Event {
+	event, err := smf.NewMetaEvent(0, metaType, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+func newTestMIDI(t *testing.T, ticksPerQuarter uint16, tracks ...*smf.Track) *smf.MIDIFile {
+	division, err := smf.NewDivision(ticksPerQuarter, smf.NOSMTPE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	midi, err := smf.NewSMF(smf.Format1, *division)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, track := range tracks {
+		if err := midi.AddTrack(track); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return midi
+}
+
+// Returns the events of a track other than End of Track, formatted to compare in tests
+func describeEvents(track *smf.Track) []string {
+	var described []string
+	for _, te := range absoluteEvents(track) {
+		if isEndOfTrackEvent(te.event) {
+			continue
+		}
+		described = append(described, describeEvent(te))
+	}
+	return described
+}
+
+// Formats an event as its tick, a name for its status, its channel and its data (e.g., "960 on 0 [60 100]")
+func describeEvent(te timedEvent) string {
+	names := map[uint8]string{
+		smf.NoteOnStatus:           "on",
+		smf.NoteOffStatus:          "off",
+		smf.ControllerChangeStatus: "cc",
+		smf.ProgramChangeStatus:    "program",
+		smf.PitchBendStatus:        "bend",
+	}
+	name, ok := names[te.event.GetStatus()]
+	if !ok {
+		return fmt.Sprintf("%d meta %d %v", te.tick, te.event.GetMetaType(), te.event.GetData())
+	}
+	return fmt.Sprintf("%d %v %d %v", te.tick, name, te.event.GetChannel(), te.event.GetData())
+}
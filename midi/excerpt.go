@@ -0,0 +1,131 @@
+package midi
+
+import (
+	"fmt"
+
+	"github.com/Try431/EasyMIDI/smf"
+)
+
+// ExcerptStartBar the first bar of the excerpt to cut out of the song (default 0: whole song)
+var ExcerptStartBar = 0
+
+// ExcerptEndBar the last bar (inclusive) of the excerpt to cut out of the song
+var ExcerptEndBar = 0
+
+// Returns the filename suffix used for bar-range excerpts (e.g., "_bars40-56")
+func excerptSuffix() string {
+	return fmt.Sprintf("_bars%d-%d", ExcerptStartBar, ExcerptEndBar)
+}
+
+// Cuts every track down to the ticks between start and end
+func sliceTracks(tracks []*smf.Track, start uint32, end uint32) []*smf.Track {
+	var slicedTracks []*smf.Track
+	for _, track := range tracks {
+		slicedTracks = append(slicedTracks, sliceTrack(track, start, end))
+	}
+	return slicedTracks
+}
+
+// Returns a self-contained copy of the track covering only the ticks between start and end - the tempo, time signature,
+// program, controller and pitch bend state in force at start is written at the beginning of the new track, notes that are
+// still held at start are struck again at the beginning of the new track, and notes still sounding at end are cut off there
+func sliceTrack(track *smf.Track, start uint32, end uint32) *smf.Track {
+	// stateEvents holds the latest event of each kind seen before start, in the order the kinds first appeared
+	var stateKeys []string
+	stateEvents := make(map[string]smf.Event)
+	// notes that were started before start, in the order they were first started - a note that's been let go of is nil
+	var heldOverKeys []string
+	heldOverNotes := make(map[string]smf.Event)
+	// notes that are sounding inside the slice - they're cut off at end
+	soundingNotes := make(map[string]smf.Event)
+	// notes let go of inside the slice
+	releasedNotes := make(map[string]bool)
+
+	var slicedEvents []timedEvent
+	for _, te := range absoluteEvents(track) {
+		if isEndOfTrackEvent(te.event) {
+			continue
+		}
+		noteKey := noteKeyOf(te.event)
+
+		// a note let go of right at start doesn't need striking again
+		if te.tick < start || (te.tick == start && isNoteOff(te.event)) {
+			if isNoteOn(te.event) {
+				if _, seen := heldOverNotes[noteKey]; !seen {
+					heldOverKeys = append(heldOverKeys, noteKey)
+				}
+				heldOverNotes[noteKey] = te.event
+			} else if isNoteOff(te.event) {
+				heldOverNotes[noteKey] = nil
+			} else if key, ok := stateKeyOf(te.event); ok {
+				if _, seen := stateEvents[key]; !seen {
+					stateKeys = append(stateKeys, key)
+				}
+				stateEvents[key] = te.event
+			}
+			continue
+		}
+
+		// note-offs landing exactly on end still belong to the slice
+		if te.tick > end || (te.tick == end && !isNoteOff(te.event)) {
+			break
+		}
+
+		if isNoteOn(te.event) {
+			soundingNotes[noteKey] = te.event
+		} else if isNoteOff(te.event) {
+			delete(soundingNotes, noteKey)
+			releasedNotes[noteKey] = true
+		}
+		slicedEvents = append(slicedEvents, timedEvent{tick: te.tick - start, event: te.event})
+	}
+
+	var newEvents []timedEvent
+	for _, key := range stateKeys {
+		newEvents = append(newEvents, timedEvent{tick: 0, event: stateEvents[key]})
+	}
+	for _, key := range heldOverKeys {
+		if note := heldOverNotes[key]; note != nil {
+			newEvents = append(newEvents, timedEvent{tick: 0, event: note})
+			if !releasedNotes[key] {
+				soundingNotes[key] = note
+			}
+		}
+	}
+	newEvents = append(newEvents, slicedEvents...)
+	for _, note := range soundingNotes {
+		newEvents = append(newEvents, timedEvent{tick: end - start, event: newChannelEvent(smf.NoteOffStatus, note.GetChannel(), note.GetData()[0], 0)})
+	}
+	return trackFromAbsoluteEvents(newEvents)
+}
+
+// Identifies a note by channel and pitch so note-ons can be paired with their note-offs
+func noteKeyOf(e smf.Event) string {
+	if !isNoteOn(e) && !isNoteOff(e) {
+		return ""
+	}
+	return fmt.Sprint(e.GetChannel(), "/", e.GetData()[0])
+}
+
+// Returns the key under which an event is kept as part of the state carried into a slice - only the last event of each
+// kind before the slice matters. Events that aren't part of the state (e.g., markers and lyrics) return false.
+func stateKeyOf(e smf.Event) (string, bool) {
+	switch e.GetStatus() {
+	case smf.MetaStatus:
+		switch e.GetMetaType() {
+		case smf.MetaSequenceTrackName, smf.MetaInstrumentName, smf.MetaMIDIChannelPrefix, smf.MetaMIDIPort,
+			smf.MetaSetTempo, smf.MetaTimeSignature, smf.MetaKeySignature:
+			return fmt.Sprint("meta/", e.GetMetaType()), true
+		}
+		return "", false
+	case smf.SysexStatus, smf.SysexDataStatus:
+		return fmt.Sprint("sysex/", e.GetData()), true
+	case smf.ProgramChangeStatus:
+		return fmt.Sprint("program/", e.GetChannel()), true
+	case smf.ControllerChangeStatus:
+		return fmt.Sprint("controller/", e.GetChannel(), "/", e.GetData()[0]), true
+	case smf.PitchBendStatus:
+		return fmt.Sprint("pitchbend/", e.GetChannel()), true
+	}
+	return "", false
+}
@@ -0,0 +1,101 @@
+package midi
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Try431/EasyMIDI/smf"
+)
+
+func TestSliceTrack(t *testing.T) {
+	tests := []struct {
+		name   string
+		events [][]timedEvent
+		start  uint32
+		end    uint32
+		want   []string
+	}{
+		{
+			name:   "a note inside the slice",
+			events: [][]timedEvent{testNote(0, 60, 100, 1920, 480)},
+			start:  960,
+			end:    2880,
+			want:   []string{"960 on 0 [60 100]", "1440 off 0 [60 0]"},
+		},
+		{
+			name:   "a note held across the start is struck again",
+			events: [][]timedEvent{testNote(0, 60, 100, 0, 1920)},
+			start:  960,
+			end:    2880,
+			want:   []string{"0 on 0 [60 100]", "960 off 0 [60 0]"},
+		},
+		{
+			name:   "a note let go of right at the start isn't struck again",
+			events: [][]timedEvent{testNote(0, 60, 100, 0, 960)},
+			start:  960,
+			end:    2880,
+			want:   nil,
+		},
+		{
+			name:   "a note held across the end is cut off there",
+			events: [][]timedEvent{testNote(0, 60, 100, 1920, 1920)},
+			start:  960,
+			end:    2880,
+			want:   []string{"960 on 0 [60 100]", "1920 off 0 [60 0]"},
+		},
+		{
+			name:   "a note held across the whole slice",
+			events: [][]timedEvent{testNote(0, 60, 100, 0, 3840)},
+			start:  960,
+			end:    2880,
+			want:   []string{"0 on 0 [60 100]", "1920 off 0 [60 0]"},
+		},
+		{
+			name: "the latest program, controllers and pitch bend are carried over",
+			events: [][]timedEvent{
+				{
+					{tick: 0, event: newChannelEvent(smf.ProgramChangeStatus, 0, 40, 0)},
+					{tick: 0, event: newChannelEvent(smf.ControllerChangeStatus, 0, volumeControllerNum, 100)},
+					{tick: 0, event: newChannelEvent(smf.ControllerChangeStatus, 0, 10, 64)},
+					{tick: 240, event: newChannelEvent(smf.PitchBendStatus, 0, 0, 80)},
+					{tick: 480, event: newChannelEvent(smf.ControllerChangeStatus, 0, volumeControllerNum, 70)},
+					{tick: 480, event: newChannelEvent(smf.ProgramChangeStatus, 0, 41, 0)},
+				},
+				testNote(0, 60, 100, 1920, 480),
+			},
+			start: 960,
+			end:   2880,
+			want: []string{
+				"0 program 0 [41]",
+				"0 cc 0 [7 70]",
+				"0 cc 0 [10 64]",
+				"0 bend 0 [0 80]",
+				"960 on 0 [60 100]",
+				"1440 off 0 [60 0]",
+			},
+		},
+		{
+			name: "events after the end are left out",
+			events: [][]timedEvent{
+				testNote(0, 60, 100, 960, 1920),
+				{{tick: 2880, event: newChannelEvent(smf.ControllerChangeStatus, 0, volumeControllerNum, 70)}},
+				testNote(0, 62, 100, 2880, 480),
+			},
+			start: 960,
+			end:   2880,
+			want:  []string{"0 on 0 [60 100]", "1920 off 0 [60 0]"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var events []timedEvent
+			for _, e := range test.events {
+				events = append(events, e...)
+			}
+			got := describeEvents(sliceTrack(trackFromAbsoluteEvents(events), test.start, test.end))
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
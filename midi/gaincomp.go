@@ -0,0 +1,75 @@
+package midi
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/Try431/EasyMIDI/smf"
+)
+
+// GainCompensation when true, each track's volume is scaled by how loud its notes are played compared to the other tracks, so the
+// emphasized and non-emphasized volumes sound the way they're set no matter what velocities the tracks were written with
+var GainCompensation = false
+
+// once its gain is applied, a track's loudest note can be at most this many times the reference velocity - a part with quiet
+// passages and loud accents would otherwise be balanced on its quiet passages alone, leaving its accents louder than anything else
+const maxPeakOverReference = 1.5
+
+// Measures the velocities of every track with notes in it, and returns how much each track's volume should be scaled by to bring
+// its average velocity in line with the quietest track's (the reference velocity), capped so its peak velocity stays within
+// maxPeakOverReference of the reference - the gains are at most 1, so a scaled volume never goes past the highest volume MIDI
+// allows and the emphasized track stays as far above the rest as it was set. Tracks without notes are left out
+func velocityGains(midi *smf.MIDIFile) map[uint16]float64 {
+	averageVelocities := make(map[uint16]float64)
+	peakVelocities := make(map[uint16]uint8)
+	referenceVelocity := math.Inf(1)
+	for trackNum := uint16(0); trackNum < midi.GetTracksNum(); trackNum++ {
+		average, peak, ok := measureVelocities(midi.GetTrack(trackNum))
+		if !ok {
+			continue
+		}
+		printWrapper(fmt.Sprintf("Track %d has an average velocity of %.1f and a peak velocity of %d", trackNum, average, peak))
+		averageVelocities[trackNum] = average
+		peakVelocities[trackNum] = peak
+		referenceVelocity = math.Min(referenceVelocity, average)
+	}
+
+	peakLimit := referenceVelocity * maxPeakOverReference
+	gains := make(map[uint16]float64)
+	for trackNum, average := range averageVelocities {
+		gains[trackNum] = math.Min(referenceVelocity/average, peakLimit/float64(peakVelocities[trackNum]))
+	}
+	return gains
+}
+
+// Returns the average and peak velocity of a track's notes - returns false if the track has no notes
+func measureVelocities(track *smf.Track) (float64, uint8, bool) {
+	noteCount := 0
+	velocitySum := 0
+	peak := uint8(0)
+	iter := track.GetIterator()
+	for iter.MoveNext() {
+		if !isNoteOn(iter.GetValue()) {
+			continue
+		}
+		velocity := iter.GetValue().GetData()[1]
+		noteCount++
+		velocitySum += int(velocity)
+		if velocity > peak {
+			peak = velocity
+		}
+	}
+	if noteCount == 0 {
+		return 0, 0, false
+	}
+	return float64(velocitySum) / float64(noteCount), peak, true
+}
+
+// Returns volume scaled by the track's gain from velocityGains() - tracks without a gain keep volume as is
+func compensatedVolume(volume uint8, gains map[uint16]float64, trackNum uint16) uint8 {
+	gain, ok := gains[trackNum]
+	if !ok {
+		return volume
+	}
+	return uint8(math.Round(float64(volume) * gain))
+}
@@ -0,0 +1,57 @@
+package midi
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Try431/EasyMIDI/smf"
+)
+
+func TestVelocityGains(t *testing.T) {
+	header := trackFromAbsoluteEvents([]timedEvent{{tick: 0, event: testMetaEvent(t, smf.MetaSequenceTrackName, []byte("Song"))}})
+	midi := newTestMIDI(t, outputTicksPerQuarter,
+		header,
+		testTrack(0, []uint8{64, 64, 64, 64}),
+		testTrack(1, []uint8{96, 96, 96, 96}),
+		// quiet passages with a loud accent - the quietest track on average
+		testTrack(2, []uint8{30, 30, 30, 127}),
+	)
+	gains := velocityGains(midi)
+
+	if _, ok := gains[0]; ok {
+		t.Errorf("the header track, which has no notes, was given a gain")
+	}
+	reference := (30 + 30 + 30 + 127) / 4.0
+	peakLimit := reference * maxPeakOverReference
+	tests := []struct {
+		name  string
+		track uint16
+		want  float64
+	}{
+		{"brought down to the reference velocity", 1, reference / 64},
+		{"brought further down for playing louder", 2, reference / 96},
+		{"brought down for its accent rather than its average", 3, peakLimit / 127},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := gains[tt.track]; math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("gain = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	for track, gain := range gains {
+		if gain > 1 {
+			t.Errorf("track %d has a gain of %v, want at most 1", track, gain)
+		}
+	}
+}
+
+func TestCompensatedVolume(t *testing.T) {
+	gains := map[uint16]float64{1: 0.5}
+	if volume := compensatedVolume(100, gains, 1); volume != 50 {
+		t.Errorf("compensated volume = %d, want 50", volume)
+	}
+	if volume := compensatedVolume(100, gains, 2); volume != 100 {
+		t.Errorf("volume of a track without a gain = %d, want it unchanged at 100", volume)
+	}
+}
@@ -0,0 +1,43 @@
+package midi
+
+import (
+	"fmt"
+
+	"github.com/Try431/EasyMIDI/smf"
+)
+
+// LadderVolumes the volumes the emphasized track steps down through in a learning ladder series, one file per step (default empty: no series)
+var LadderVolumes []uint8
+
+// Turns every variant into a learning ladder series - one variant per entry in LadderVolumes with the emphasized tracks set to that
+// volume (scaled by trackGains when gain compensation is on), named in order (e.g., "_step1" ... "_step4")
+func expandVariantsIntoLadder(variants []outputVariant, trackGains map[uint16]float64) []outputVariant {
+	var ladderVariants []outputVariant
+	for _, variant := range variants {
+		for step, volume := range LadderVolumes {
+			var steppedTracks []*smf.Track
+			for k, track := range variant.tracksAtFullVolume {
+				steppedTracks = append(steppedTracks, setTrackVolume(track, compensatedVolume(volume, trackGains, uint16(k))))
+			}
+			ladderVariants = append(ladderVariants, outputVariant{
+				suffix:                  fmt.Sprintf("%v_step%d", variant.suffix, step+1),
+				tracksAtFullVolume:      steppedTracks,
+				tracksWithLoweredVolume: variant.tracksWithLoweredVolume,
+			})
+		}
+	}
+	return ladderVariants
+}
+
+// Returns a new track with its volume control MIDI event set to volume - tracks without one (e.g., header tracks) are returned as is
+func setTrackVolume(track *smf.Track, volume uint8) *smf.Track {
+	eventPos := uint32(0)
+	iter := track.GetIterator()
+	for iter.MoveNext() {
+		if iter.GetValue().GetStatus() == controlChangeStatusNum && iter.GetValue().GetData()[0] == volumeControllerNum {
+			return createNewTrack(track, eventPos, createNewVolumeEvent(track, volume, iter.GetValue().GetChannel()))
+		}
+		eventPos++
+	}
+	return track
+}
@@ -0,0 +1,96 @@
+package midi
+
+import (
+	"math"
+
+	"github.com/Try431/EasyMIDI/smf"
+)
+
+// LayerOriginalInstrument can be used as the LayerInstrumentNum to double the emphasized track with its original instrument
+const LayerOriginalInstrument = 128
+
+// LayerInstrumentNum the number corresponding to the instrument the emphasized track is doubled with on a spare channel,
+// or LayerOriginalInstrument to keep the track's own instrument (default -1: no layer)
+var LayerInstrumentNum = -1
+
+// LayerVolume the volume of the layer doubling the emphasized track (default 70)
+var LayerVolume = uint8(70)
+
+// LayerPrimaryVolume the volume of the emphasized track itself when it's layered (default 100)
+var LayerPrimaryVolume = EmphasizedTrackVolume
+
+// Returns the volume the emphasized track should be set to
+func emphasizedTrackVolume() uint8 {
+	if LayerInstrumentNum >= 0 {
+		return LayerPrimaryVolume
+	}
+	return EmphasizedTrackVolume
+}
+
+// Returns the volume the layer plays at while the emphasized track is at emphasizedVolume - the layer keeps the balance between
+// LayerVolume and LayerPrimaryVolume, so it follows the emphasized track down a ladder step or a gain compensation (and is silent
+// when the emphasized track is). With a LayerPrimaryVolume of 0 the layer is all there is of the emphasized track, so it plays at
+// LayerVolume
+func layerVolume(emphasizedVolume uint8) uint8 {
+	if LayerPrimaryVolume == 0 {
+		return LayerVolume
+	}
+	return uint8(math.Min(127, math.Round(float64(emphasizedVolume)*float64(LayerVolume)/float64(LayerPrimaryVolume))))
+}
+
+// Creates a copy of the emphasized track's MIDI events on a spare channel, playing LayerInstrumentNum at layerVolume() - the
+// instrument changes are taken from originalTrack instead, the same track before it was given the emphasized instrument, so
+// LayerOriginalInstrument can find the track's own instrument. Returns false for header tracks or if there's no spare channel
+// for the layer.
+func createLayerTrack(emphasizedTrack *smf.Track, originalTrack *smf.Track, tracks []*smf.Track) (*smf.Track, bool) {
+	if isHeader, _ := isHeaderTrackAndGetTrackChannel(emphasizedTrack); isHeader {
+		return nil, false
+	}
+	spareChannels := unusedChannels(tracks)
+	if len(spareChannels) == 0 {
+		printWrapper("No spare MIDI channel left for the emphasized track's layer - skipping it")
+		return nil, false
+	}
+	channel := spareChannels[0]
+
+	var layerEvents []timedEvent
+	hasProgramChange := false
+	for _, te := range absoluteEvents(originalTrack) {
+		if te.event.GetStatus() != programChangeStatusNum {
+			continue
+		}
+		hasProgramChange = true
+		program := te.event.GetData()[0]
+		if LayerInstrumentNum != LayerOriginalInstrument {
+			program = uint8(LayerInstrumentNum)
+		}
+		layerEvents = append(layerEvents, timedEvent{tick: te.tick, event: newChannelEvent(programChangeStatusNum, channel, program, 0)})
+	}
+
+	hasVolume := false
+	for _, te := range absoluteEvents(emphasizedTrack) {
+		if !smf.CheckMIDIStatus(te.event.GetStatus()) || te.event.GetStatus() == programChangeStatusNum {
+			continue
+		}
+		data := te.event.GetData()
+		firstDataByte, secondDataByte := data[0], uint8(0)
+		if len(data) > 1 {
+			secondDataByte = data[1]
+		}
+		if te.event.GetStatus() == controlChangeStatusNum && firstDataByte == volumeControllerNum {
+			hasVolume = true
+			secondDataByte = layerVolume(secondDataByte)
+		}
+		layerEvents = append(layerEvents, timedEvent{tick: te.tick, event: newChannelEvent(te.event.GetStatus(), channel, firstDataByte, secondDataByte)})
+	}
+
+	// a new channel starts out on instrument 0 at volume 100, so make sure the layer's own settings are in place
+	var setupEvents []timedEvent
+	if !hasProgramChange && LayerInstrumentNum != LayerOriginalInstrument {
+		setupEvents = append(setupEvents, timedEvent{tick: 0, event: newChannelEvent(programChangeStatusNum, channel, uint8(LayerInstrumentNum), 0)})
+	}
+	if !hasVolume {
+		setupEvents = append(setupEvents, timedEvent{tick: 0, event: newChannelEvent(controlChangeStatusNum, channel, volumeControllerNum, LayerVolume)})
+	}
+	return trackFromAbsoluteEvents(append(setupEvents, layerEvents...)), true
+}
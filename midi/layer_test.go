@@ -0,0 +1,83 @@
+package midi
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Try431/EasyMIDI/smf"
+)
+
+// Sets the layer settings for a test - the returned function puts them back
+func setLayerSettings(instrument int, volume uint8, primaryVolume uint8) func() {
+	oldInstrument, oldVolume, oldPrimaryVolume := LayerInstrumentNum, LayerVolume, LayerPrimaryVolume
+	LayerInstrumentNum, LayerVolume, LayerPrimaryVolume = instrument, volume, primaryVolume
+	return func() {
+		LayerInstrumentNum, LayerVolume, LayerPrimaryVolume = oldInstrument, oldVolume, oldPrimaryVolume
+	}
+}
+
+func TestLayerVolume(t *testing.T) {
+	tests := []struct {
+		name             string
+		primaryVolume    uint8
+		emphasizedVolume uint8
+		want             uint8
+	}{
+		{"emphasized track at its own volume", 100, 100, 70},
+		{"emphasized track turned down a ladder step or by gain compensation", 100, 50, 35},
+		{"emphasized track left out", 100, 0, 0},
+		{"layer louder than the emphasized track", 50, 100, 127},
+		{"layer all there is of the emphasized track", 0, 0, 70},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer setLayerSettings(LayerOriginalInstrument, 70, tt.primaryVolume)()
+			if got := layerVolume(tt.emphasizedVolume); got != tt.want {
+				t.Errorf("layerVolume(%d) = %d, want %d", tt.emphasizedVolume, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateLayerTrack(t *testing.T) {
+	original := trackFromAbsoluteEvents(append([]timedEvent{
+		{tick: 0, event: newChannelEvent(programChangeStatusNum, 0, 40, 0)},
+		{tick: 0, event: newChannelEvent(controlChangeStatusNum, 0, volumeControllerNum, 40)},
+	}, testNote(0, 60, 100, 960, 960)...))
+	// the emphasized version of the track - another instrument, a ladder step's volume, and a pitch cue before the music
+	emphasized := trackFromAbsoluteEvents(append(append([]timedEvent{
+		{tick: 0, event: newChannelEvent(programChangeStatusNum, 0, 65, 0)},
+		{tick: 0, event: newChannelEvent(controlChangeStatusNum, 0, volumeControllerNum, 50)},
+	}, testNote(0, 60, 80, 0, 480)...), testNote(0, 60, 100, 960, 960)...))
+
+	tests := []struct {
+		name       string
+		instrument int
+		want       []string
+	}{
+		{
+			name:       "the track's own instrument",
+			instrument: LayerOriginalInstrument,
+			want: []string{"0 program 1 [40]", "0 cc 1 [7 35]", "0 on 1 [60 80]", "480 off 1 [60 0]", "960 on 1 [60 100]",
+				"1920 off 1 [60 0]"},
+		},
+		{
+			name:       "an instrument of its own",
+			instrument: 0,
+			want: []string{"0 program 1 [0]", "0 cc 1 [7 35]", "0 on 1 [60 80]", "480 off 1 [60 0]", "960 on 1 [60 100]",
+				"1920 off 1 [60 0]"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer setLayerSettings(tt.instrument, 70, 100)()
+			layer, ok := createLayerTrack(emphasized, original, []*smf.Track{emphasized})
+			if !ok {
+				t.Fatalf("no layer was created")
+			}
+			if got := describeEvents(layer); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("layer events = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
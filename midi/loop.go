@@ -0,0 +1,115 @@
+package midi
+
+import (
+	"fmt"
+
+	"github.com/Try431/EasyMIDI/smf"
+)
+
+// LoopStartBar the first bar of the passage to repeat for loop practice (default 0: no loop file)
+var LoopStartBar = 0
+
+// LoopEndBar the last bar (inclusive) of the passage to repeat for loop practice
+var LoopEndBar = 0
+
+// LoopRepetitions the number of times the passage is played in a loop file (default 4)
+var LoopRepetitions = 4
+
+// LoopGapBeats the number of beats of silence between repetitions of the passage (default 0)
+var LoopGapBeats = 0
+
+// LoopCountIn when true, the gap between repetitions is filled with a click on every beat (defaults to a bar long gap if LoopGapBeats isn't set)
+var LoopCountIn = false
+
+// the number corresponding to the instrument the count-in clicks are played on (115: woodblock), and the note they're played at
+const (
+	countInClickInstrumentNum = uint8(115)
+	countInClickNote          = uint8(84)
+)
+
+// General MIDI percussion note used for count-in clicks when there's no spare channel for them (76: hi wood block)
+const countInClickPercussionNote = uint8(76)
+
+// velocity of the count-in clicks
+const countInClickVelocity = uint8(100)
+
+// Returns the filename suffix used for loop files (e.g., "_loop40-56_x4")
+func loopSuffix() string {
+	return fmt.Sprintf("_loop%d-%d_x%d", LoopStartBar, LoopEndBar, LoopRepetitions)
+}
+
+// Builds the loop practice variant of a song - every track is cut down to the loop's bars and repeated LoopRepetitions times,
+// and a click track is added when a count-in is wanted. The click track only goes after the lowered tracks, so it plays under
+// every emphasized file without getting one of its own
+func createLoopVariant(tracksAtFullVolume []*smf.Track, tracksWithLoweredVolume []*smf.Track) outputVariant {
+	timeSignatures := newTimeSignatureMap(tracksWithLoweredVolume)
+	start := timeSignatures.barStartTick(LoopStartBar)
+	end := timeSignatures.barStartTick(LoopEndBar + 1)
+
+	beat := timeSignatures.beatLengthAt(start)
+	gapBeats := LoopGapBeats
+	if LoopCountIn && gapBeats == 0 {
+		gapBeats = int(timeSignatures.timeSignatureAt(start).numerator)
+	}
+	gap := uint32(gapBeats) * beat
+
+	variant := outputVariant{
+		suffix:                  loopSuffix(),
+		tracksAtFullVolume:      repeatTracks(tracksAtFullVolume, start, end, gap),
+		tracksWithLoweredVolume: repeatTracks(tracksWithLoweredVolume, start, end, gap),
+	}
+
+	if LoopCountIn && gap > 0 {
+		clickTrack := createCountInTrack(variant.tracksWithLoweredVolume, end-start, gap, beat)
+		variant.tracksWithLoweredVolume = append(variant.tracksWithLoweredVolume, clickTrack)
+	}
+	return variant
+}
+
+// Cuts every track down to the ticks between start and end, and plays that slice LoopRepetitions times with gap ticks in between
+func repeatTracks(tracks []*smf.Track, start uint32, end uint32, gap uint32) []*smf.Track {
+	var repeatedTracks []*smf.Track
+	for _, track := range sliceTracks(tracks, start, end) {
+		var repeatedEvents []timedEvent
+		for r := 0; r < LoopRepetitions; r++ {
+			offset := uint32(r) * (end - start + gap)
+			for _, te := range absoluteEvents(track) {
+				// the track name only needs to appear once
+				if r > 0 && te.event.GetStatus() == smf.MetaStatus && te.event.GetMetaType() == smf.MetaSequenceTrackName {
+					continue
+				}
+				repeatedEvents = append(repeatedEvents, timedEvent{tick: te.tick + offset, event: te.event})
+			}
+		}
+		repeatedTracks = append(repeatedTracks, trackFromAbsoluteEvents(repeatedEvents))
+	}
+	return repeatedTracks
+}
+
+// Creates a track that clicks on every beat of the gaps between repetitions of a loop - the clicks get a spare channel of their
+// own at full volume, so lowering the song's percussion doesn't quieten them, and only fall back to the percussion channel when
+// every other channel is taken
+func createCountInTrack(tracks []*smf.Track, loopLength uint32, gap uint32, beat uint32) *smf.Track {
+	channel, note := percussionChannel, countInClickPercussionNote
+	var clickEvents []timedEvent
+	if spareChannels := unusedChannels(tracks); len(spareChannels) > 0 {
+		channel, note = spareChannels[0], countInClickNote
+		clickEvents = append(clickEvents,
+			timedEvent{tick: 0, event: newChannelEvent(programChangeStatusNum, channel, countInClickInstrumentNum, 0)},
+			timedEvent{tick: 0, event: newChannelEvent(controlChangeStatusNum, channel, volumeControllerNum, EmphasizedTrackVolume)},
+		)
+	} else {
+		printWrapper("No spare MIDI channel left for the count-in clicks - playing them on the percussion channel")
+	}
+
+	for r := 1; r < LoopRepetitions; r++ {
+		gapStart := uint32(r)*(loopLength+gap) - gap
+		for tick := gapStart; tick < gapStart+gap; tick += beat {
+			clickEvents = append(clickEvents,
+				timedEvent{tick: tick, event: newChannelEvent(smf.NoteOnStatus, channel, note, countInClickVelocity)},
+				timedEvent{tick: tick + beat/2, event: newChannelEvent(smf.NoteOffStatus, channel, note, 0)},
+			)
+		}
+	}
+	return trackFromAbsoluteEvents(clickEvents)
+}
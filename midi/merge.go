@@ -0,0 +1,114 @@
+package midi
+
+import (
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/Try431/EasyMIDI/smf"
+)
+
+// MergeAndSplitParts merges several single-part MIDI files into one score and splits it into voice parts like SplitParts does,
+// with output files named after mergedFileName
+func MergeAndSplitParts(mainWg *sync.WaitGroup, midiFilePaths []string, mergedFileName string) {
+	defer mainWg.Done()
+	var midiFiles []*smf.MIDIFile
+	var partNames []string
+	for _, midiFilePath := range midiFilePaths {
+		midiFiles = append(midiFiles, readMIDIFile(midiFilePath))
+		partNames = append(partNames, strings.TrimSuffix(filepath.Base(midiFilePath), filepath.Ext(midiFilePath)))
+	}
+	printWrapper("Merging " + strings.Join(partNames, ", ") + " into " + mergedFileName)
+	splitMIDIFile(mergeMIDIFiles(midiFiles, partNames), mergedFileName)
+}
+
+// Merges MIDI files into one Format 1 file - the first track holds the tempo map, time signatures, key signatures and markers of
+// the first file, and every file's MIDI events are gathered into one track named after it. Each file's timing is converted through
+// real time, so the files line up even when their divisions or tempo maps differ.
+func mergeMIDIFiles(midiFiles []*smf.MIDIFile, partNames []string) *smf.MIDIFile {
+	division, err := smf.NewDivision(outputTicksPerQuarter, smf.NOSMTPE)
+	if err != nil {
+		log.Fatalf("Failed to create new Division object with error: %v", err)
+	}
+	mergedMIDIFile, err := smf.NewSMF(smf.Format1, *division)
+	if err != nil {
+		log.Fatalf("Failed to create new MIDI object with error: %v", err)
+	}
+
+	// the first file's tempo map becomes the merged file's, at the merged file's division
+	firstTempoMap := newTempoMap(midiFiles[0])
+	mergedTempoMap := firstTempoMap.atOutputDivision()
+
+	var conductorEvents []timedEvent
+	for trackNum := uint16(0); trackNum < midiFiles[0].GetTracksNum(); trackNum++ {
+		for _, te := range absoluteEvents(midiFiles[0].GetTrack(trackNum)) {
+			if te.event.GetStatus() != smf.MetaStatus {
+				continue
+			}
+			switch te.event.GetMetaType() {
+			case smf.MetaSetTempo, smf.MetaTimeSignature, smf.MetaKeySignature, smf.MetaMarker, smf.MetaCuePoint:
+				tick := mergedTempoMap.microsecondsToTick(firstTempoMap.tickToMicroseconds(te.tick))
+				conductorEvents = append(conductorEvents, timedEvent{tick: tick, event: te.event})
+			}
+		}
+	}
+	mergedMIDIFile.AddTrack(trackFromAbsoluteEvents(conductorEvents))
+
+	for i, midiFile := range midiFiles {
+		fileTempoMap := newTempoMap(midiFile)
+		var partEvents []timedEvent
+		for trackNum := uint16(0); trackNum < midiFile.GetTracksNum(); trackNum++ {
+			for _, te := range absoluteEvents(midiFile.GetTrack(trackNum)) {
+				isMetaEvent := te.event.GetStatus() == smf.MetaStatus
+				if isMetaEvent && te.event.GetMetaType() != smf.MetaLyric && te.event.GetMetaType() != smf.MetaText {
+					continue
+				}
+				tick := mergedTempoMap.microsecondsToTick(fileTempoMap.tickToMicroseconds(te.tick))
+				partEvents = append(partEvents, timedEvent{tick: tick, event: te.event})
+			}
+		}
+		mergedMIDIFile.AddTrack(createPartTrack(partNames[i], partEvents))
+	}
+	return mergedMIDIFile
+}
+
+// Builds a track for one part of a merged score, named partName. The splitter needs a program change and a volume control MIDI event
+// for each part to replace, so a part that doesn't set those up gets the General MIDI defaults (instrument 0 at volume 100).
+func createPartTrack(partName string, partEvents []timedEvent) *smf.Track {
+	nameEvent, err := smf.NewMetaEvent(0, smf.MetaSequenceTrackName, []byte(partName))
+	if err != nil {
+		log.Fatalf("Failed to create new track name event with error: %v", err)
+	}
+	setupEvents := []timedEvent{{tick: 0, event: nameEvent}}
+
+	usedChannels := make(map[uint8]bool)
+	hasProgramChange := make(map[uint8]bool)
+	hasVolume := make(map[uint8]bool)
+	var channels []uint8
+	for _, te := range partEvents {
+		if !smf.CheckMIDIStatus(te.event.GetStatus()) {
+			continue
+		}
+		channel := te.event.GetChannel()
+		if !usedChannels[channel] {
+			usedChannels[channel] = true
+			channels = append(channels, channel)
+		}
+		if te.event.GetStatus() == programChangeStatusNum {
+			hasProgramChange[channel] = true
+		}
+		if te.event.GetStatus() == controlChangeStatusNum && te.event.GetData()[0] == volumeControllerNum {
+			hasVolume[channel] = true
+		}
+	}
+	for _, channel := range channels {
+		if !hasProgramChange[channel] {
+			setupEvents = append(setupEvents, timedEvent{tick: 0, event: newChannelEvent(programChangeStatusNum, channel, 0, 0)})
+		}
+		if !hasVolume[channel] {
+			setupEvents = append(setupEvents, timedEvent{tick: 0, event: newChannelEvent(controlChangeStatusNum, channel, volumeControllerNum, EmphasizedTrackVolume)})
+		}
+	}
+	return trackFromAbsoluteEvents(append(setupEvents, partEvents...))
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"sort"
 	"strconv"
@@ -14,6 +13,7 @@ import (
 
 	"github.com/Try431/EasyMIDI/smf"
 	"github.com/Try431/EasyMIDI/smfio"
+	"github.com/Try431/MIDI-part-splitter/render"
 )
 
 // 0xCn is the code for setting a program change command for channel n
@@ -45,10 +45,22 @@ var MP3OutputDirectory = "output/mp3s"
 // SilenceOutput when true, effectively stops all output to stdout
 var SilenceOutput = false
 
-// outputMIDIFilePaths is a slice of the full filepaths of the MIDI files created by writeNewMIDIFile() -- this slice will be accessed by the conversion bash script
-var outputMIDIFilePaths []string
+// AudioRenderer renders the output MIDI files to audio (default: fluidsynth and ffmpeg)
+var AudioRenderer render.Renderer = render.NewFluidSynth(render.DefaultConfig())
+
+// outputRenderJobs holds the full filepaths of the MIDI files created by writeNewMIDIFile(), along with the emphasized track of
+// each -- this slice will be accessed by AudioRenderer
+var outputRenderJobs []render.Job
 var filepathLock sync.RWMutex
 
+// outputVariant is one set of emphasized MIDI files to be written for a song (e.g., an excerpt or a section of it),
+// with suffix appended to the name of each file in the set
+type outputVariant struct {
+	suffix                  string
+	tracksAtFullVolume      []*smf.Track
+	tracksWithLoweredVolume []*smf.Track
+}
+
 func printWrapper(toPrint string) {
 	if !SilenceOutput {
 		fmt.Println(toPrint)
@@ -58,10 +70,14 @@ func printWrapper(toPrint string) {
 // SplitParts splits the MIDI file into different voice parts and creates new MIDI files
 // with those voice parts emphasized
 func SplitParts(mainWg *sync.WaitGroup, midiFilePath string) {
-	outputMIDIFilePaths = []string{}
 	defer mainWg.Done()
-	file, err := os.Open(midiFilePath)
 	midiFileName := strings.TrimSuffix(filepath.Base(midiFilePath), filepath.Ext(midiFilePath))
+	splitMIDIFile(readMIDIFile(midiFilePath), midiFileName)
+}
+
+// Opens a MIDI file and reads it into an smf.MIDIFile struct
+func readMIDIFile(midiFilePath string) *smf.MIDIFile {
+	file, err := os.Open(midiFilePath)
 	if err != nil {
 		log.Fatalf("Failed to open %v with error: %v", midiFilePath, err)
 	}
@@ -72,12 +88,35 @@ func SplitParts(mainWg *sync.WaitGroup, midiFilePath string) {
 	if err != nil {
 		log.Fatalf("Failed to read MIDI file %v with error: %v", file, err)
 	}
+	return midi
+}
+
+// Does the actual splitting for SplitParts, with output files named after midiFileName
+func splitMIDIFile(midi *smf.MIDIFile, midiFileName string) {
+	outputRenderJobs = []render.Job{}
+
+	// every output is written at outputTicksPerQuarter, and bars, beats and rests are all measured at it
+	midi = rescaleToOutputDivision(midi)
+	midi = removeInvalidTimeSignatures(midi)
+
+	if len(SubSplitTracks) > 0 {
+		midi = subSplitTracks(midi)
+	}
+
+	// tracks that share a channel can't be emphasized separately, so give each its own
+	midi = reallocateSharedChannels(midi)
 
 	// collecting record of all tracks in the MIDI file so we can construct our new MIDI files in the same track order
 	var tracksWithLoweredVolume []*smf.Track
 	var tracksAtFullVolume []*smf.Track
 	trackNameMap := make(map[uint16]string)
 
+	// tracks played with different velocities don't sound as loud as each other at the same volume, so scale their volumes to match
+	trackGains := make(map[uint16]float64)
+	if GainCompensation {
+		trackGains = velocityGains(midi)
+	}
+
 	// iterating through all tracks in MIDI file
 	for currentTrackNum := uint16(0); currentTrackNum < midi.GetTracksNum(); currentTrackNum++ {
 		curTrack := midi.GetTrack(currentTrackNum)
@@ -105,11 +144,11 @@ func SplitParts(mainWg *sync.WaitGroup, midiFilePath string) {
 		// create an emphasized track with the new instrument and at full volume
 		eventPos = uint32(0)
 		highVolIter := newInstrumentTrack.GetIterator()
-		highVolumeEvent := createNewVolumeEvent(curTrack, EmphasizedTrackVolume, trackChannel)
+		highVolumeEvent := createNewVolumeEvent(curTrack, compensatedVolume(emphasizedTrackVolume(), trackGains, currentTrackNum), trackChannel)
 		for highVolIter.MoveNext() {
 			if highVolIter.GetValue().GetStatus() == controlChangeStatusNum && highVolIter.GetValue().GetData()[0] == volumeControllerNum {
 				newVolAndInstrumentTrack := createNewTrack(newInstrumentTrack, eventPos, highVolumeEvent)
-				tracksAtFullVolume = append(tracksAtFullVolume, newVolAndInstrumentTrack)
+				tracksAtFullVolume = append(tracksAtFullVolume, setTrackSends(newVolAndInstrumentTrack, EmphasizedReverbSend, EmphasizedChorusSend))
 				break
 			}
 			eventPos++
@@ -121,7 +160,7 @@ func SplitParts(mainWg *sync.WaitGroup, midiFilePath string) {
 
 		// get all midi events via iterator
 		iter := curTrack.GetIterator()
-		lowVolumeMIDIEvent := createNewVolumeEvent(curTrack, NonEmphasizedTrackVolume, trackChannel)
+		lowVolumeMIDIEvent := createNewVolumeEvent(curTrack, compensatedVolume(NonEmphasizedTrackVolume, trackGains, currentTrackNum), trackChannel)
 
 		eventPos = uint32(0)
 		for iter.MoveNext() {
@@ -132,7 +171,7 @@ func SplitParts(mainWg *sync.WaitGroup, midiFilePath string) {
 			// once we've found the MIDI event that's setting the channel volume, replace the old MIDI event with one that has the desired channel volume
 			if iter.GetValue().GetStatus() == controlChangeStatusNum && iter.GetValue().GetData()[0] == volumeControllerNum {
 				newVolumeTrack := createNewTrack(curTrack, eventPos, lowVolumeMIDIEvent)
-				tracksWithLoweredVolume = append(tracksWithLoweredVolume, newVolumeTrack)
+				tracksWithLoweredVolume = append(tracksWithLoweredVolume, setTrackSends(newVolumeTrack, BackgroundReverbSend, BackgroundChorusSend))
 				break
 			}
 			eventPos++
@@ -145,11 +184,99 @@ func SplitParts(mainWg *sync.WaitGroup, midiFilePath string) {
 		}
 	}
 
+	// the piano reduction only goes after the lowered tracks, so it plays under every emphasized file without getting one of
+	// its own
+	reductionTrackNum := -1
+	if PianoReduction {
+		if reductionTrack, ok := createReductionTrack(tracksWithLoweredVolume); ok {
+			reductionTrackNum = len(tracksWithLoweredVolume)
+			tracksWithLoweredVolume = append(tracksWithLoweredVolume, reductionTrack)
+		}
+	}
+
+	var variants []outputVariant
+	if ExcerptStartBar > 0 {
+		timeSignatures := newTimeSignatureMap(tracksWithLoweredVolume)
+		// an excerpt that starts after the song ends, or ends before it starts, would only write silent files
+		if ExcerptEndBar < ExcerptStartBar {
+			log.Fatalf("Bar range %d-%d not accepted with error: the excerpt ends before it starts", ExcerptStartBar, ExcerptEndBar)
+		}
+		if songBars := timeSignatures.barCount(songEndTick(tracksWithLoweredVolume)); ExcerptStartBar > songBars {
+			log.Fatalf("Bar range %d-%d not accepted with error: the song only has %d bars", ExcerptStartBar, ExcerptEndBar, songBars)
+		}
+		start := timeSignatures.barStartTick(ExcerptStartBar)
+		end := timeSignatures.barStartTick(ExcerptEndBar + 1)
+		variants = append(variants, outputVariant{
+			suffix:                  excerptSuffix(),
+			tracksAtFullVolume:      sliceTracks(tracksAtFullVolume, start, end),
+			tracksWithLoweredVolume: sliceTracks(tracksWithLoweredVolume, start, end),
+		})
+	}
+	if LoopStartBar > 0 {
+		variants = append(variants, createLoopVariant(tracksAtFullVolume, tracksWithLoweredVolume))
+	}
+	// without an excerpt or a loop, the whole song is written
+	if len(variants) == 0 {
+		variants = append(variants, outputVariant{tracksAtFullVolume: tracksAtFullVolume, tracksWithLoweredVolume: tracksWithLoweredVolume})
+	}
+
+	if SplitBySections {
+		variants = splitVariantsBySections(variants)
+	}
+
+	if len(LadderVolumes) > 0 {
+		variants = expandVariantsIntoLadder(variants, trackGains)
+	}
+
+	for _, variant := range variants {
+		if PitchCueMode != "" {
+			variant.tracksAtFullVolume, variant.tracksWithLoweredVolume = addPitchCues(variant.tracksAtFullVolume, variant.tracksWithLoweredVolume)
+		}
+
+		newMIDIFilesToBeCreated := createEmphasizedMIDIFiles(variant.tracksAtFullVolume, variant.tracksWithLoweredVolume, trackGains)
+		writeNewMIDIFiles(newMIDIFilesToBeCreated, trackNameMap, midiFileName, variant.suffix)
+		if reductionTrackNum >= 0 {
+			writeReductionMIDIFile(variant.tracksWithLoweredVolume, reductionTrackNum, trackNameMap, midiFileName, variant.suffix)
+		}
+		renderVariant()
+	}
+}
+
+// Renders the output files written for one variant - they're mixed from the same stems, so each part is only rendered once
+// per volume and instrument, and they're trimmed alike. Variants are rendered one after another, so a short variant (e.g., a
+// section) is trimmed on its own and only one variant's stems are held in memory at a time
+func renderVariant() {
+	filepathLock.Lock()
+	jobs := outputRenderJobs
+	outputRenderJobs = []render.Job{}
+	filepathLock.Unlock()
+
+	song := render.NewSong(len(jobs))
+	var convertWg sync.WaitGroup
+	convertWg.Add(len(jobs))
+	for _, job := range jobs {
+		job.Song = song
+		go renderAudioFile(&convertWg, job)
+	}
+	convertWg.Wait()
+}
+
+// Builds one MIDI file per track, in which that track is taken from tracksAtFullVolume and every other track from tracksWithLoweredVolume.
+// Tracks past the end of tracksAtFullVolume (e.g., a count-in click or the piano reduction) play under every file as they are -
+// they're never emphasized, reorchestrated or ducked
+func createEmphasizedMIDIFiles(tracksAtFullVolume []*smf.Track, tracksWithLoweredVolume []*smf.Track, trackGains map[uint16]float64) []*smf.MIDIFile {
 	var newMIDIFilesToBeCreated []*smf.MIDIFile
 	var emphasizedTrackNum = uint16(0)
+	timeSignatures := newTimeSignatureMap(tracksWithLoweredVolume)
+	// the background instrument is only swapped in here, so the extra tracks below can still see each track's own instrument
+	backgroundTracks := tracksWithLoweredVolume
+	if BackgroundInstrumentNum >= 0 {
+		partTracks := tracksWithBackgroundInstrument(tracksWithLoweredVolume[:len(tracksAtFullVolume)])
+		backgroundTracks = append(partTracks, tracksWithLoweredVolume[len(tracksAtFullVolume):]...)
+	}
 	for i := 0; i < len(tracksAtFullVolume); i++ {
 		// create division
-		division, err := smf.NewDivision(960, smf.NOSMTPE)
+		division, err := smf.NewDivision(outputTicksPerQuarter, smf.NOSMTPE)
 		if err != nil {
 			log.Printf("Failed to create new Division object with error: %v", err)
 		}
@@ -161,59 +288,73 @@ func SplitParts(mainWg *sync.WaitGroup, midiFilePath string) {
 		}
 
 		fullVolTrack := tracksAtFullVolume[emphasizedTrackNum]
+		var emphasizedPhrases []phrase
+		if DynamicDucking {
+			emphasizedPhrases = soundingPhrases(fullVolTrack)
+		}
 		for k := 0; k < len(tracksWithLoweredVolume); k++ {
 			if uint16(k) == emphasizedTrackNum {
 				newMIDIFile.AddTrack(fullVolTrack)
+			} else if DynamicDucking && k < len(tracksAtFullVolume) {
+				restVolume := compensatedVolume(DuckedRestVolume, trackGains, uint16(k))
+				duckedVolume := compensatedVolume(NonEmphasizedTrackVolume, trackGains, uint16(k))
+				newMIDIFile.AddTrack(duckTrack(backgroundTracks[k], emphasizedPhrases, restVolume, duckedVolume))
 			} else {
-				newMIDIFile.AddTrack(tracksWithLoweredVolume[k])
+				newMIDIFile.AddTrack(backgroundTracks[k])
+			}
+		}
+
+		// extra tracks that only belong in this track's emphasized file - songTracks keeps track of every track in the file
+		// so each extra track can find its own spare channel
+		songTracks := append([]*smf.Track{fullVolTrack}, tracksWithLoweredVolume...)
+		if LayerInstrumentNum >= 0 {
+			// the layer doubles the emphasized track as it's heard (cues, sends and volume included), with the instruments
+			// of the track as it was
+			if layerTrack, ok := createLayerTrack(fullVolTrack, tracksWithLoweredVolume[i], songTracks); ok {
+				newMIDIFile.AddTrack(layerTrack)
+				songTracks = append(songTracks, layerTrack)
+			}
+		}
+		if OctaveDoubling != 0 {
+			if doublingTrack, ok := createOctaveDoublingTrack(fullVolTrack); ok {
+				newMIDIFile.AddTrack(doublingTrack)
+				songTracks = append(songTracks, doublingTrack)
+			}
+		}
+		if EntranceCueRestBars > 0 {
+			if cueTrack, ok := createEntranceCueTrack(fullVolTrack, songTracks, timeSignatures); ok {
+				newMIDIFile.AddTrack(cueTrack)
+				songTracks = append(songTracks, cueTrack)
 			}
 		}
 		newMIDIFilesToBeCreated = append(newMIDIFilesToBeCreated, newMIDIFile)
 		emphasizedTrackNum++
 	}
+	return newMIDIFilesToBeCreated
+}
 
+// Writes out the MIDI files created by createEmphasizedMIDIFiles(), with suffix appended to each file name
+func writeNewMIDIFiles(newMIDIFiles []*smf.MIDIFile, trackNameMap map[uint16]string, midiFileName string, suffix string) {
 	var wg sync.WaitGroup
-	wg.Add(len(newMIDIFilesToBeCreated))
-	for num, mFile := range newMIDIFilesToBeCreated {
-		go writeNewMIDIFile(&wg, num, mFile, trackNameMap, midiFileName)
+	wg.Add(len(newMIDIFiles))
+	for num, mFile := range newMIDIFiles {
+		go writeNewMIDIFile(&wg, num, mFile, num, trackNameMap, midiFileName, suffix)
 	}
 	wg.Wait()
-
-	var convertWg sync.WaitGroup
-	convertWg.Add(len(outputMIDIFilePaths))
-	for _, filepath := range outputMIDIFilePaths {
-		go runConversionScript(&convertWg, filepath)
-	}
-	convertWg.Wait()
 }
 
-func runConversionScript(wg *sync.WaitGroup, filepath string) {
+// Renders one of the output MIDI files to audio in MP3OutputDirectory
+func renderAudioFile(wg *sync.WaitGroup, job render.Job) {
 	defer wg.Done()
-	cmd := exec.Command("/bin/bash", "convert/convert_async.sh", filepath, MP3OutputDirectory, strconv.FormatBool(SilenceOutput))
-	// create a pipe for the output of the script
-	cmdReader, err := cmd.StdoutPipe()
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error creating StdoutPipe for Cmd", err)
-		return
-	}
-
-	scanner := bufio.NewScanner(cmdReader)
-	go func() {
-		for scanner.Scan() {
-			fmt.Printf("%s\n", scanner.Text())
-		}
-	}()
-
-	err = cmd.Start()
+	printWrapper(fmt.Sprintf("Converting '%v' to an audio file in '%v'", job.MIDIPath, MP3OutputDirectory))
+	result, err := AudioRenderer.Render(job, MP3OutputDirectory)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error starting Cmd", err)
+		fmt.Fprintln(os.Stderr, err)
 		return
 	}
-
-	err = cmd.Wait()
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "Error waiting for Cmd", err)
-		return
+	if loudness := result.Loudness; loudness != nil {
+		printWrapper(fmt.Sprintf("Normalized '%v' from %.1f LUFS (true peak %.1f dBTP) to %.1f LUFS (true peak %.1f dBTP)", result.AudioPath,
+			loudness.Measured.Integrated, loudness.Measured.TruePeak, loudness.Normalized.Integrated, loudness.Normalized.TruePeak))
 	}
 }
 
@@ -261,14 +402,19 @@ func handleDuplicateTrackNames(trackNameMap map[uint16]string) map[uint16]string
 	return newTrackNameMap
 }
 
-// Creates the output .mid files
-func writeNewMIDIFile(wg *sync.WaitGroup, fileNum int, newMidiFile *smf.MIDIFile, trackNameMap map[uint16]string, midiFileName string) {
+// Creates the output .mid files - leadTrack is the emphasized track of the file, or -1 if it doesn't have one
+func writeNewMIDIFile(wg *sync.WaitGroup, fileNum int, newMidiFile *smf.MIDIFile, leadTrack int, trackNameMap map[uint16]string, midiFileName string, suffix string) {
 	defer wg.Done()
+	writeOutputMIDIFile(fileNum, newMidiFile, leadTrack, trackNameMap, midiFileName, suffix)
+}
+
+// Does the writing for writeNewMIDIFile, for callers that write a single file and don't need a WaitGroup
+func writeOutputMIDIFile(fileNum int, newMidiFile *smf.MIDIFile, leadTrack int, trackNameMap map[uint16]string, midiFileName string, suffix string) {
 	var newFileName string
 	trackNameMap = handleDuplicateTrackNames(trackNameMap)
 	// if the track didn't have a name (e.g., a track consisting only of META_EVENT's), we skip the .mid file creation
 	if trackName, ok := trackNameMap[uint16(fileNum)]; ok {
-		newFileName = "./" + MIDIOutputDirectory + "/" + midiFileName + "_" + trackName + ".mid"
+		newFileName = "./" + MIDIOutputDirectory + "/" + midiFileName + "_" + trackName + suffix + ".mid"
 	} else {
 		return
 	}
@@ -290,7 +436,7 @@ func writeNewMIDIFile(wg *sync.WaitGroup, fileNum int, newMidiFile *smf.MIDIFile
 	smfio.Write(writer, newMidiFile)
 	writer.Flush()
 	filepathLock.Lock()
-	outputMIDIFilePaths = append(outputMIDIFilePaths, newFileName)
+	outputRenderJobs = append(outputRenderJobs, render.Job{MIDIPath: newFileName, LeadTrack: leadTrack})
 	filepathLock.Unlock()
 }
 
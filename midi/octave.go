@@ -0,0 +1,108 @@
+package midi
+
+import (
+	"github.com/Try431/EasyMIDI/smf"
+)
+
+// OctaveDoubling the number of octaves (e.g., 1 for up or -1 for down) at which the emphasized track's notes are doubled (default 0: no doubling)
+var OctaveDoubling = 0
+
+// OctaveDoublingLowestNote the lowest note the doubling is allowed to play - doubled notes below it are left out (default 21: A0)
+var OctaveDoublingLowestNote = uint8(21)
+
+// OctaveDoublingHighestNote the highest note the doubling is allowed to play - doubled notes above it are left out (default 108: C8)
+var OctaveDoublingHighestNote = uint8(108)
+
+// channelPitch is a pitch on a channel
+type channelPitch struct {
+	channel uint8
+	pitch   uint8
+}
+
+// doubledNote is a doubled note - noteOn and noteOff are the indexes of its events in the doubling's events
+type doubledNote struct {
+	pitch   channelPitch
+	start   uint32
+	noteOn  int
+	noteOff int
+}
+
+// Creates a track that doubles the emphasized track's notes OctaveDoubling octaves away, on the emphasized track's own channel -
+// returns false if none of its notes can be doubled. A doubled note and an original one at the same pitch on the same channel
+// would end each other, so a note isn't doubled onto a pitch the original is playing, and a doubled note is ended (or left out,
+// if it's only just started) when the original starts playing its pitch
+func createOctaveDoublingTrack(emphasizedTrack *smf.Track) (*smf.Track, bool) {
+	// the pitches sounding in the original track
+	originalSounding := make(map[channelPitch]bool)
+	// the doubled note for each original note that's currently being doubled, and the original note for each doubled pitch
+	doubledSounding := make(map[channelPitch]doubledNote)
+	doubledFrom := make(map[channelPitch]channelPitch)
+	// the last doubled note to end at each pitch
+	doubledEnded := make(map[channelPitch]doubledNote)
+
+	var doublingEvents []timedEvent
+	leftOut := make(map[int]bool)
+	for _, te := range absoluteEvents(emphasizedTrack) {
+		if !isNoteOn(te.event) && !isNoteOff(te.event) {
+			continue
+		}
+		original := channelPitch{channel: te.event.GetChannel(), pitch: te.event.GetData()[0]}
+
+		if isNoteOn(te.event) {
+			// a doubled note at this pitch is ended a tick before the original note starts, so its note-off can't be taken for
+			// the original note's - one that's only just started is left out
+			if source, ok := doubledFrom[original]; ok {
+				doubled := doubledSounding[source]
+				if doubled.start == te.tick {
+					leftOut[doubled.noteOn] = true
+				} else {
+					doublingEvents = append(doublingEvents, timedEvent{tick: te.tick - 1, event: newChannelEvent(smf.NoteOffStatus, original.channel, original.pitch, 0)})
+				}
+				delete(doubledSounding, source)
+				delete(doubledFrom, original)
+			} else if doubled, ok := doubledEnded[original]; ok && doublingEvents[doubled.noteOff].tick == te.tick {
+				if doubled.start == te.tick {
+					leftOut[doubled.noteOn], leftOut[doubled.noteOff] = true, true
+				} else {
+					doublingEvents[doubled.noteOff].tick--
+				}
+			}
+			originalSounding[original] = true
+
+			doubledPitch := int(original.pitch) + 12*OctaveDoubling
+			if doubledPitch < int(OctaveDoublingLowestNote) || doubledPitch > int(OctaveDoublingHighestNote) {
+				continue
+			}
+			doubled := channelPitch{channel: original.channel, pitch: uint8(doubledPitch)}
+			if _, ok := doubledSounding[original]; ok || originalSounding[doubled] {
+				continue
+			}
+			if _, ok := doubledFrom[doubled]; ok {
+				continue
+			}
+			doubledSounding[original] = doubledNote{pitch: doubled, start: te.tick, noteOn: len(doublingEvents)}
+			doubledFrom[doubled] = original
+			doublingEvents = append(doublingEvents, timedEvent{tick: te.tick, event: newChannelEvent(smf.NoteOnStatus, doubled.channel, doubled.pitch, te.event.GetData()[1])})
+		} else {
+			delete(originalSounding, original)
+			if doubled, ok := doubledSounding[original]; ok {
+				delete(doubledSounding, original)
+				delete(doubledFrom, doubled.pitch)
+				doubled.noteOff = len(doublingEvents)
+				doubledEnded[doubled.pitch] = doubled
+				doublingEvents = append(doublingEvents, timedEvent{tick: te.tick, event: newChannelEvent(smf.NoteOffStatus, doubled.pitch.channel, doubled.pitch.pitch, 0)})
+			}
+		}
+	}
+
+	var keptEvents []timedEvent
+	for i, te := range doublingEvents {
+		if !leftOut[i] {
+			keptEvents = append(keptEvents, te)
+		}
+	}
+	if len(keptEvents) == 0 {
+		return nil, false
+	}
+	return trackFromAbsoluteEvents(keptEvents), true
+}
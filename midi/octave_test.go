@@ -0,0 +1,64 @@
+package midi
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCreateOctaveDoublingTrack(t *testing.T) {
+	oldOctaves := OctaveDoubling
+	OctaveDoubling = 1
+	defer func() { OctaveDoubling = oldOctaves }()
+
+	tests := []struct {
+		name  string
+		notes [][]timedEvent
+		want  []string
+	}{
+		{
+			name:  "a note doubled an octave up",
+			notes: [][]timedEvent{testNote(0, 60, 100, 0, 960)},
+			want:  []string{"0 on 0 [72 100]", "960 off 0 [72 0]"},
+		},
+		{
+			name:  "the original plays the pitch a doubled note is sounding",
+			notes: [][]timedEvent{testNote(0, 60, 100, 0, 1920), testNote(0, 72, 90, 960, 480)},
+			want:  []string{"0 on 0 [72 100]", "959 off 0 [72 0]", "960 on 0 [84 90]", "1440 off 0 [84 0]"},
+		},
+		{
+			name:  "the original already plays the doubled pitch",
+			notes: [][]timedEvent{testNote(0, 72, 90, 0, 1920), testNote(0, 60, 100, 960, 480)},
+			want:  []string{"0 on 0 [84 90]", "1920 off 0 [84 0]"},
+		},
+		{
+			name:  "the original starts the doubled pitch along with the doubled note",
+			notes: [][]timedEvent{testNote(0, 60, 100, 0, 960), testNote(0, 72, 90, 0, 960)},
+			want:  []string{"0 on 0 [84 90]", "960 off 0 [84 0]"},
+		},
+		{
+			name:  "the original moves to the doubled pitch as the doubled note ends",
+			notes: [][]timedEvent{testNote(0, 60, 100, 0, 960), testNote(0, 72, 90, 960, 960)},
+			want:  []string{"0 on 0 [72 100]", "959 off 0 [72 0]", "960 on 0 [84 90]", "1920 off 0 [84 0]"},
+		},
+		{
+			name:  "the same pitches on another channel",
+			notes: [][]timedEvent{testNote(0, 60, 100, 0, 1920), testNote(1, 72, 90, 960, 480)},
+			want:  []string{"0 on 0 [72 100]", "960 on 1 [84 90]", "1440 off 1 [84 0]", "1920 off 0 [72 0]"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var events []timedEvent
+			for _, note := range tt.notes {
+				events = append(events, note...)
+			}
+			doubling, ok := createOctaveDoublingTrack(trackFromAbsoluteEvents(events))
+			if !ok {
+				t.Fatalf("no doubling was created")
+			}
+			if got := describeEvents(doubling); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("doubling events = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package midi
+
+import (
+	"github.com/Try431/EasyMIDI/smf"
+)
+
+const (
+	// PitchCueAll plays every part's starting pitch, one beat each, in score order
+	PitchCueAll = "all"
+	// PitchCueEmphasized plays only the emphasized part's starting pitch
+	PitchCueEmphasized = "emphasized"
+)
+
+// PitchCueMode when set to PitchCueAll or PitchCueEmphasized, a starting-pitch cue is played before the music (default off)
+var PitchCueMode = ""
+
+// velocity of the notes played in the starting-pitch cue
+const pitchCueVelocity = uint8(100)
+
+// Delays every track and writes each part's first sounding pitch into the gap before the music starts -
+// in PitchCueAll mode the cue is written to both versions of every track, otherwise only to the emphasized ones. Tracks that
+// only play in the background (those past the end of tracksAtFullVolume) are delayed without a cue
+func addPitchCues(tracksAtFullVolume []*smf.Track, tracksWithLoweredVolume []*smf.Track) ([]*smf.Track, []*smf.Track) {
+	beat := uint32(outputTicksPerQuarter)
+
+	// work out which beat of the cue each track's pitch will be played on
+	cueSlots := make(map[int]uint32)
+	for k, track := range tracksWithLoweredVolume[:len(tracksAtFullVolume)] {
+		// percussion doesn't have a pitch to give
+		if _, channel, ok := firstSoundingNote(track); !ok || channel == percussionChannel {
+			continue
+		}
+		if PitchCueMode == PitchCueAll {
+			cueSlots[k] = uint32(len(cueSlots))
+		} else {
+			cueSlots[k] = 0
+		}
+	}
+
+	// leave a beat of silence between the last cue note and the music
+	cueLength := 2 * beat
+	if PitchCueMode == PitchCueAll {
+		cueLength = uint32(len(cueSlots)+1) * beat
+	}
+
+	var cuedFullVolumeTracks []*smf.Track
+	var cuedLoweredVolumeTracks []*smf.Track
+	for k := range tracksAtFullVolume {
+		slot, hasCue := cueSlots[k]
+
+		fullVolumeEvents := delayTrack(tracksAtFullVolume[k], cueLength)
+		loweredVolumeEvents := delayTrack(tracksWithLoweredVolume[k], cueLength)
+		if hasCue {
+			fullVolumeEvents = append(fullVolumeEvents, pitchCueEvents(tracksAtFullVolume[k], slot*beat, beat)...)
+			if PitchCueMode == PitchCueAll {
+				loweredVolumeEvents = append(loweredVolumeEvents, pitchCueEvents(tracksWithLoweredVolume[k], slot*beat, beat)...)
+			}
+		}
+		cuedFullVolumeTracks = append(cuedFullVolumeTracks, trackFromAbsoluteEvents(fullVolumeEvents))
+		cuedLoweredVolumeTracks = append(cuedLoweredVolumeTracks, trackFromAbsoluteEvents(loweredVolumeEvents))
+	}
+	for _, track := range tracksWithLoweredVolume[len(tracksAtFullVolume):] {
+		cuedLoweredVolumeTracks = append(cuedLoweredVolumeTracks, trackFromAbsoluteEvents(delayTrack(track, cueLength)))
+	}
+	return cuedFullVolumeTracks, cuedLoweredVolumeTracks
+}
+
+// Returns a note-on/note-off pair for the track's first sounding pitch, slightly shorter than length so repeated pitches re-articulate
+func pitchCueEvents(track *smf.Track, start uint32, length uint32) []timedEvent {
+	pitch, channel, _ := firstSoundingNote(track)
+	return []timedEvent{
+		{tick: start, event: newChannelEvent(smf.NoteOnStatus, channel, pitch, pitchCueVelocity)},
+		{tick: start + length - length/8, event: newChannelEvent(smf.NoteOffStatus, channel, pitch, 0)},
+	}
+}
@@ -0,0 +1,147 @@
+package midi
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/Try431/EasyMIDI/smf"
+)
+
+// Moves tracks that share a MIDI channel with an earlier track onto unused channels, so that changing one track's volume or instrument
+// doesn't change the other's too. The program and controller setup the moved track relied on from the tracks it shared with is
+// repeated at the start of the moved track. The percussion channel is left alone, since drum tracks are meant to share it.
+func reallocateSharedChannels(midi *smf.MIDIFile) *smf.MIDIFile {
+	var tracks []*smf.Track
+	for trackNum := uint16(0); trackNum < midi.GetTracksNum(); trackNum++ {
+		tracks = append(tracks, midi.GetTrack(trackNum))
+	}
+
+	// the tracks using each channel, in track order
+	channelTracks := make(map[uint8][]int)
+	for trackNum, track := range tracks {
+		for _, channel := range trackChannels(track) {
+			if channel != percussionChannel {
+				channelTracks[channel] = append(channelTracks[channel], trackNum)
+			}
+		}
+	}
+
+	reallocated := false
+	for channel := uint8(0); channel <= smf.MaxChannelNumber; channel++ {
+		sharingTracks := channelTracks[channel]
+		// the first track on the channel gets to keep it
+		for i := 1; i < len(sharingTracks); i++ {
+			spareChannels := unusedChannels(tracks)
+			if len(spareChannels) == 0 {
+				printWrapper("No spare MIDI channel left - tracks sharing channel " + fmt.Sprint(channel+1) + " will be emphasized together")
+				break
+			}
+			trackNum := sharingTracks[i]
+			printWrapper(fmt.Sprintf("Track %d shares channel %d with track %d - moving it to channel %d", trackNum, channel+1, sharingTracks[0], spareChannels[0]+1))
+
+			var otherTracks []*smf.Track
+			for j, otherTrackNum := range sharingTracks {
+				if j != i {
+					otherTracks = append(otherTracks, tracks[otherTrackNum])
+				}
+			}
+			tracks[trackNum] = moveTrackToChannel(tracks[trackNum], otherTracks, channel, spareChannels[0])
+			reallocated = true
+		}
+	}
+	if !reallocated {
+		return midi
+	}
+
+	newMIDIFile, err := smf.NewSMF(midi.GetFormat(), midi.GetDivision())
+	if err != nil {
+		log.Fatalf("Failed to create new MIDI object with error: %v", err)
+	}
+	for _, track := range tracks {
+		newMIDIFile.AddTrack(track)
+	}
+	return newMIDIFile
+}
+
+// Returns every channel used by a MIDI_EVENT in the track
+func trackChannels(track *smf.Track) []uint8 {
+	var channels []uint8
+	seen := make(map[uint8]bool)
+	iter := track.GetIterator()
+	for iter.MoveNext() {
+		if smf.CheckMIDIStatus(iter.GetValue().GetStatus()) && !seen[iter.GetValue().GetChannel()] {
+			seen[iter.GetValue().GetChannel()] = true
+			channels = append(channels, iter.GetValue().GetChannel())
+		}
+	}
+	return channels
+}
+
+// Returns a copy of the track with its events on oldChannel moved to newChannel. Program, controller and pitch bend settings that other
+// tracks had put in place on oldChannel by the time the track's first note plays are repeated at the start of the new track, unless the
+// track sets them itself.
+func moveTrackToChannel(track *smf.Track, otherTracks []*smf.Track, oldChannel uint8, newChannel uint8) *smf.Track {
+	events := absoluteEvents(track)
+
+	firstNoteTick := uint32(0)
+	ownSettings := make(map[string]bool)
+	for _, te := range events {
+		if isNoteOn(te.event) {
+			firstNoteTick = te.tick
+			break
+		}
+	}
+	for _, te := range events {
+		if te.tick > firstNoteTick {
+			break
+		}
+		if key, ok := stateKeyOf(te.event); ok && smf.CheckMIDIStatus(te.event.GetStatus()) {
+			ownSettings[key] = true
+		}
+	}
+
+	// collect the latest of each setting the other tracks made on the channel before the first note
+	var inheritedKeys []string
+	inheritedSettings := make(map[string]smf.Event)
+	for _, otherTrack := range otherTracks {
+		for _, te := range absoluteEvents(otherTrack) {
+			if te.tick > firstNoteTick {
+				break
+			}
+			if !smf.CheckMIDIStatus(te.event.GetStatus()) || te.event.GetChannel() != oldChannel {
+				continue
+			}
+			key, ok := stateKeyOf(te.event)
+			if !ok || ownSettings[key] {
+				continue
+			}
+			if _, seen := inheritedSettings[key]; !seen {
+				inheritedKeys = append(inheritedKeys, key)
+			}
+			inheritedSettings[key] = te.event
+		}
+	}
+
+	// the inherited settings go in just before the track's first MIDI_EVENT, so meta events like the track name still lead the track
+	var movedEvents []timedEvent
+	for _, te := range events {
+		if len(inheritedKeys) > 0 && smf.CheckMIDIStatus(te.event.GetStatus()) {
+			for _, key := range inheritedKeys {
+				movedEvents = append(movedEvents, timedEvent{tick: te.tick, event: inheritedSettings[key]})
+			}
+			inheritedKeys = nil
+		}
+		movedEvents = append(movedEvents, te)
+	}
+	for i, te := range movedEvents {
+		if smf.CheckMIDIStatus(te.event.GetStatus()) && te.event.GetChannel() == oldChannel {
+			data := te.event.GetData()
+			secondDataByte := uint8(0)
+			if len(data) > 1 {
+				secondDataByte = data[1]
+			}
+			movedEvents[i].event = newChannelEvent(te.event.GetStatus(), newChannel, data[0], secondDataByte)
+		}
+	}
+	return trackFromAbsoluteEvents(movedEvents)
+}
@@ -0,0 +1,135 @@
+package midi
+
+import (
+	"log"
+	"sort"
+
+	"github.com/Try431/EasyMIDI/smf"
+)
+
+// PianoReduction when true, a piano track doubling all voice tracks is played quietly under every output and also written as its own file
+var PianoReduction = false
+
+// ReductionVolume the volume of the piano reduction under the emphasized outputs (default 50)
+var ReductionVolume = uint8(50)
+
+// ReductionTrackName the name the piano reduction is written out under
+const ReductionTrackName = "Piano_Reduction"
+
+// the number corresponding to the instrument played by the piano reduction (0: acoustic grand piano)
+const reductionInstrumentNum = uint8(0)
+
+// a track with more than this share of its notes struck while another of its notes is still sounding plays chords, so it's
+// taken to be accompaniment rather than a voice
+const accompanimentChordShare = 0.25
+
+// Creates a track that plays the notes of every voice track together on a spare channel, playing reductionInstrumentNum at
+// ReductionVolume - returns false if there's no spare channel or none of the tracks are voices with notes
+func createReductionTrack(tracks []*smf.Track) (*smf.Track, bool) {
+	spareChannels := unusedChannels(tracks)
+	if len(spareChannels) == 0 {
+		printWrapper("No spare MIDI channel left for the piano reduction - skipping it")
+		return nil, false
+	}
+	channel := spareChannels[0]
+
+	var noteEvents []timedEvent
+	for _, track := range tracks {
+		if !isVoiceTrack(track) {
+			continue
+		}
+		for _, te := range absoluteEvents(track) {
+			if isNoteOn(te.event) || isNoteOff(te.event) {
+				noteEvents = append(noteEvents, te)
+			}
+		}
+	}
+	if len(noteEvents) == 0 {
+		return nil, false
+	}
+	// note-offs go before note-ons on the same tick, so a voice letting go of a pitch another voice then sings doesn't cut it off
+	sort.SliceStable(noteEvents, func(i, j int) bool {
+		if noteEvents[i].tick != noteEvents[j].tick {
+			return noteEvents[i].tick < noteEvents[j].tick
+		}
+		return isNoteOff(noteEvents[i].event) && isNoteOn(noteEvents[j].event)
+	})
+
+	trackName, err := smf.NewMetaEvent(0, smf.MetaSequenceTrackName, []byte(ReductionTrackName))
+	if err != nil {
+		log.Fatalf("Failed to create track name event with error: %v", err)
+	}
+	reductionEvents := []timedEvent{
+		{tick: 0, event: trackName},
+		{tick: 0, event: newChannelEvent(programChangeStatusNum, channel, reductionInstrumentNum, 0)},
+		{tick: 0, event: newChannelEvent(controlChangeStatusNum, channel, volumeControllerNum, ReductionVolume)},
+	}
+
+	// voices singing in unison share a pitch on the one channel - the pitch is struck again for each voice that comes in,
+	// but only let go of once every voice has
+	soundingVoices := make(map[uint8]int)
+	for _, te := range noteEvents {
+		pitch := te.event.GetData()[0]
+		if isNoteOn(te.event) {
+			if soundingVoices[pitch] > 0 {
+				reductionEvents = append(reductionEvents, timedEvent{tick: te.tick, event: newChannelEvent(smf.NoteOffStatus, channel, pitch, 0)})
+			}
+			soundingVoices[pitch]++
+			reductionEvents = append(reductionEvents, timedEvent{tick: te.tick, event: newChannelEvent(smf.NoteOnStatus, channel, pitch, te.event.GetData()[1])})
+		} else if soundingVoices[pitch] > 0 {
+			soundingVoices[pitch]--
+			if soundingVoices[pitch] == 0 {
+				reductionEvents = append(reductionEvents, timedEvent{tick: te.tick, event: newChannelEvent(smf.NoteOffStatus, channel, pitch, 0)})
+			}
+		}
+	}
+	return trackFromAbsoluteEvents(reductionEvents), true
+}
+
+// Returns whether a track is a voice part - a non-percussion track that sings one note at a time, rather than accompaniment
+// playing chords
+func isVoiceTrack(track *smf.Track) bool {
+	if isHeader, trackChannel := isHeaderTrackAndGetTrackChannel(track); isHeader || trackChannel == percussionChannel {
+		return false
+	}
+	notes, chordNotes := 0, 0
+	soundingNotes := make(map[uint8]bool)
+	for _, te := range absoluteEvents(track) {
+		if isNoteOn(te.event) {
+			notes++
+			if len(soundingNotes) > 0 {
+				chordNotes++
+			}
+			soundingNotes[te.event.GetData()[0]] = true
+		} else if isNoteOff(te.event) {
+			delete(soundingNotes, te.event.GetData()[0])
+		}
+	}
+	return float64(chordNotes) <= accompanimentChordShare*float64(notes)
+}
+
+// Writes the piano reduction at reductionTrackNum out as its own file, alongside the song's header tracks and at full volume -
+// it's named alongside the tracks in trackNameMap, so a track that's already called ReductionTrackName keeps its own file
+func writeReductionMIDIFile(tracks []*smf.Track, reductionTrackNum int, trackNameMap map[uint16]string, midiFileName string, suffix string) {
+	division, err := smf.NewDivision(outputTicksPerQuarter, smf.NOSMTPE)
+	if err != nil {
+		log.Printf("Failed to create new Division object with error: %v", err)
+	}
+	reductionMIDIFile, err := smf.NewSMF(smf.Format1, *division)
+	if err != nil {
+		log.Printf("Failed to create new MIDI object with error: %v", err)
+	}
+	for k, track := range tracks {
+		if k == reductionTrackNum {
+			reductionMIDIFile.AddTrack(setTrackVolume(track, EmphasizedTrackVolume))
+		} else if isHeader, _ := isHeaderTrackAndGetTrackChannel(track); isHeader {
+			reductionMIDIFile.AddTrack(track)
+		}
+	}
+
+	reductionNameMap := map[uint16]string{uint16(reductionTrackNum): ReductionTrackName}
+	for trackNum, trackName := range trackNameMap {
+		reductionNameMap[trackNum] = trackName
+	}
+	writeOutputMIDIFile(reductionTrackNum, reductionMIDIFile, -1, reductionNameMap, midiFileName, suffix)
+}
@@ -0,0 +1,87 @@
+package midi
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/Try431/EasyMIDI/smf"
+)
+
+// SplitBySections when true, a separate set of emphasized files is written for each section of the song marked by a Marker or Cue Point meta event
+var SplitBySections = false
+
+// songSection is the stretch of a song between one Marker/Cue Point meta event and the next
+type songSection struct {
+	name  string
+	start uint32
+	end   uint32
+}
+
+// Splits every variant into one variant per section, named after the section's marker (e.g., "_02_Verse_2")
+func splitVariantsBySections(variants []outputVariant) []outputVariant {
+	var sectionVariants []outputVariant
+	for _, variant := range variants {
+		sections := findSections(variant.tracksWithLoweredVolume)
+		if len(sections) == 0 {
+			printWrapper("No Marker or Cue Point events found - writing the song as a single section")
+			sectionVariants = append(sectionVariants, variant)
+			continue
+		}
+		for i, section := range sections {
+			sectionVariants = append(sectionVariants, outputVariant{
+				suffix:                  fmt.Sprintf("%v_%02d_%v", variant.suffix, i+1, section.name),
+				tracksAtFullVolume:      sliceTracks(variant.tracksAtFullVolume, section.start, section.end),
+				tracksWithLoweredVolume: sliceTracks(variant.tracksWithLoweredVolume, section.start, section.end),
+			})
+		}
+	}
+	return sectionVariants
+}
+
+// Finds the sections marked in any track - music before the first marker becomes a section of its own called "Start"
+func findSections(tracks []*smf.Track) []songSection {
+	markerNames := make(map[uint32]string)
+	songEnd := uint32(0)
+	for _, track := range tracks {
+		for _, te := range absoluteEvents(track) {
+			if te.tick > songEnd {
+				songEnd = te.tick
+			}
+			if te.event.GetStatus() != smf.MetaStatus {
+				continue
+			}
+			// markers win over cue points that land on the same tick
+			metaType := te.event.GetMetaType()
+			if metaType == smf.MetaMarker || (metaType == smf.MetaCuePoint && markerNames[te.tick] == "") {
+				// marker text is parsed the same way as track names so it can be used in file names
+				markerNames[te.tick] = grabTrackName(te.event)
+			}
+		}
+	}
+	if len(markerNames) == 0 {
+		return nil
+	}
+
+	starts := make([]uint32, 0)
+	for tick := range markerNames {
+		starts = append(starts, tick)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+	if starts[0] > 0 {
+		starts = append([]uint32{0}, starts...)
+		markerNames[0] = "Start"
+	}
+
+	var sections []songSection
+	for i, start := range starts {
+		end := songEnd
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		if end <= start {
+			continue
+		}
+		sections = append(sections, songSection{name: markerNames[start], start: start, end: end})
+	}
+	return sections
+}
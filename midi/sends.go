@@ -0,0 +1,65 @@
+package midi
+
+import (
+	"github.com/Try431/EasyMIDI/smf"
+)
+
+// EmphasizedReverbSend the reverb send (0-127) of the emphasized track (default -1: the track's own reverb is kept)
+var EmphasizedReverbSend = -1
+
+// EmphasizedChorusSend the chorus send (0-127) of the emphasized track (default -1: the track's own chorus is kept)
+var EmphasizedChorusSend = -1
+
+// BackgroundReverbSend the reverb send (0-127) of the non-emphasized tracks (default -1: each track's own reverb is kept)
+var BackgroundReverbSend = -1
+
+// BackgroundChorusSend the chorus send (0-127) of the non-emphasized tracks (default -1: each track's own chorus is kept)
+var BackgroundChorusSend = -1
+
+// 0x5B is the code for a control change number for a channel's reverb send level
+const reverbControllerNum = uint8(0x5B)
+
+// 0x5D is the code for a control change number for a channel's chorus send level
+const chorusControllerNum = uint8(0x5D)
+
+// Returns a copy of the track with its reverb and chorus sends set right after its volume control MIDI event - any reverb or chorus
+// events already in the track are replaced, and a send of -1 leaves that send as it is
+func setTrackSends(track *smf.Track, reverbSend int, chorusSend int) *smf.Track {
+	isHeader, channel := isHeaderTrackAndGetTrackChannel(track)
+	if isHeader || (reverbSend < 0 && chorusSend < 0) {
+		return track
+	}
+
+	var sendEvents []timedEvent
+	sendsWritten := false
+	for _, te := range absoluteEvents(track) {
+		if te.event.GetStatus() == controlChangeStatusNum {
+			controllerNum := te.event.GetData()[0]
+			if (controllerNum == reverbControllerNum && reverbSend >= 0) || (controllerNum == chorusControllerNum && chorusSend >= 0) {
+				continue
+			}
+		}
+		sendEvents = append(sendEvents, te)
+		if !sendsWritten && te.event.GetStatus() == controlChangeStatusNum && te.event.GetData()[0] == volumeControllerNum {
+			sendEvents = append(sendEvents, sendSettingEvents(te.tick, channel, reverbSend, chorusSend)...)
+			sendsWritten = true
+		}
+	}
+	// tracks without a volume control MIDI event get their sends at the very start
+	if !sendsWritten {
+		sendEvents = append(sendSettingEvents(0, channel, reverbSend, chorusSend), sendEvents...)
+	}
+	return trackFromAbsoluteEvents(sendEvents)
+}
+
+// Returns the control change MIDI events setting a channel's reverb and chorus sends at tick - a send of -1 is left out
+func sendSettingEvents(tick uint32, channel uint8, reverbSend int, chorusSend int) []timedEvent {
+	var events []timedEvent
+	if reverbSend >= 0 {
+		events = append(events, timedEvent{tick: tick, event: newChannelEvent(controlChangeStatusNum, channel, reverbControllerNum, uint8(reverbSend))})
+	}
+	if chorusSend >= 0 {
+		events = append(events, timedEvent{tick: tick, event: newChannelEvent(controlChangeStatusNum, channel, chorusControllerNum, uint8(chorusSend))})
+	}
+	return events
+}
@@ -0,0 +1,35 @@
+package midi
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Try431/MIDI-part-splitter/sf2"
+)
+
+// CheckInstruments makes sure the soundfonts the output files will be rendered with have presets for the emphasized and background
+// instruments, since a missing preset plays silence - a missing emphasized instrument falls back to piano, a missing background
+// instrument leaves each non-emphasized track with its own instrument, and a missing layer instrument doubles the emphasized
+// track with its own instrument instead. The emphasized and layer instruments are checked against leadSoundFont instead when the
+// emphasized tracks are rendered with one of their own (nil otherwise)
+func CheckInstruments(soundFont *sf2.SoundFont, leadSoundFont *sf2.SoundFont) {
+	emphasizedSoundFont := soundFont
+	if leadSoundFont != nil {
+		emphasizedSoundFont = leadSoundFont
+	}
+	if emphasizedSoundFont.Preset(0, uint16(EmphasizedInstrumentNum)) == nil {
+		fmt.Fprintf(os.Stderr, "Soundfont %v has no instrument number %d - emphasized tracks will be played on instrument 0 instead\n", emphasizedSoundFont.Name, EmphasizedInstrumentNum)
+		EmphasizedInstrumentNum = 0
+		if emphasizedSoundFont.Preset(0, 0) == nil {
+			fmt.Fprintf(os.Stderr, "Soundfont %v has no instrument number 0 either - emphasized tracks may be silent\n", emphasizedSoundFont.Name)
+		}
+	}
+	if LayerInstrumentNum >= 0 && LayerInstrumentNum != LayerOriginalInstrument && emphasizedSoundFont.Preset(0, uint16(LayerInstrumentNum)) == nil {
+		fmt.Fprintf(os.Stderr, "Soundfont %v has no instrument number %d - the emphasized track will be layered with its own instrument instead\n", emphasizedSoundFont.Name, LayerInstrumentNum)
+		LayerInstrumentNum = LayerOriginalInstrument
+	}
+	if BackgroundInstrumentNum >= 0 && soundFont.Preset(0, uint16(BackgroundInstrumentNum)) == nil {
+		fmt.Fprintf(os.Stderr, "Soundfont %v has no instrument number %d - non-emphasized tracks will keep their own instruments\n", soundFont.Name, BackgroundInstrumentNum)
+		BackgroundInstrumentNum = -1
+	}
+}
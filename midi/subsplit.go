@@ -0,0 +1,147 @@
+package midi
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/Try431/EasyMIDI/smf"
+)
+
+// SubSplitByChordPosition can be used as a SubSplitTracks split point to split a track into its top note and the notes below it
+const SubSplitByChordPosition = -1
+
+// SubSplitTracks the tracks (by name, as used in output file names) to split into an upper and a lower virtual part, mapped to the note
+// at which to split them (notes at or above it go to the upper part) or to SubSplitByChordPosition (default empty: no tracks split)
+var SubSplitTracks = make(map[string]int)
+
+// parts of a sub-split track that a note can be routed to
+const (
+	upperPart = 1 << iota
+	lowerPart
+)
+
+// Replaces every track named in SubSplitTracks with an upper and a lower virtual part, named after the track with "_upper" and "_lower"
+// appended. Both parts keep all of the track's other events, so they each play correctly on their own.
+func subSplitTracks(midi *smf.MIDIFile) *smf.MIDIFile {
+	newMIDIFile, err := smf.NewSMF(midi.GetFormat(), midi.GetDivision())
+	if err != nil {
+		log.Fatalf("Failed to create new MIDI object with error: %v", err)
+	}
+
+	for trackNum := uint16(0); trackNum < midi.GetTracksNum(); trackNum++ {
+		track := midi.GetTrack(trackNum)
+		splitPoint, ok := SubSplitTracks[trackNameOf(track)]
+		if !ok {
+			newMIDIFile.AddTrack(track)
+			continue
+		}
+		printWrapper(fmt.Sprint("Splitting ", trackNameOf(track), " into upper and lower parts"))
+		upperTrack, lowerTrack := splitTrackIntoParts(track, splitPoint)
+		newMIDIFile.AddTrack(upperTrack)
+		newMIDIFile.AddTrack(lowerTrack)
+	}
+	return newMIDIFile
+}
+
+// Returns the track's name the way it's used in output file names, or an empty string if the track has no name
+func trackNameOf(track *smf.Track) string {
+	iter := track.GetIterator()
+	for iter.MoveNext() {
+		if iter.GetValue().GetMetaType() == smf.MetaSequenceTrackName {
+			return grabTrackName(iter.GetValue())
+		}
+	}
+	return ""
+}
+
+// Splits the notes of a track between an upper and a lower part, either at a split point or by chord position. When splitting by chord
+// position, a note that's sounding on its own belongs to both parts (i.e., the voices are singing in unison).
+func splitTrackIntoParts(track *smf.Track, splitPoint int) (*smf.Track, *smf.Track) {
+	var upperEvents []timedEvent
+	var lowerEvents []timedEvent
+	addToParts := func(parts int, te timedEvent) {
+		if parts&upperPart != 0 {
+			upperEvents = append(upperEvents, te)
+		}
+		if parts&lowerPart != 0 {
+			lowerEvents = append(lowerEvents, te)
+		}
+	}
+
+	soundingNotes := make(map[uint8]bool)
+	// the parts each sounding pitch was sent to, so its note-off goes to the same places
+	noteParts := make(map[uint8]int)
+
+	events := absoluteEvents(track)
+	for i := 0; i < len(events); {
+		// handle all the events at one tick together, so chords can be looked at as a whole
+		j := i
+		for j < len(events) && events[j].tick == events[i].tick {
+			j++
+		}
+		group := events[i:j]
+		i = j
+
+		for _, te := range group {
+			if isNoteOn(te.event) || isNoteOff(te.event) {
+				continue
+			}
+			if te.event.GetMetaType() == smf.MetaSequenceTrackName && te.event.GetStatus() == smf.MetaStatus {
+				upperEvents = append(upperEvents, timedEvent{tick: te.tick, event: renamedTrackNameEvent(te.event, "_upper")})
+				lowerEvents = append(lowerEvents, timedEvent{tick: te.tick, event: renamedTrackNameEvent(te.event, "_lower")})
+				continue
+			}
+			addToParts(upperPart|lowerPart, te)
+		}
+		for _, te := range group {
+			if isNoteOff(te.event) {
+				pitch := te.event.GetData()[0]
+				addToParts(noteParts[pitch], te)
+				delete(noteParts, pitch)
+				delete(soundingNotes, pitch)
+			}
+		}
+		for _, te := range group {
+			if isNoteOn(te.event) {
+				soundingNotes[te.event.GetData()[0]] = true
+			}
+		}
+		for _, te := range group {
+			if isNoteOn(te.event) {
+				pitch := te.event.GetData()[0]
+				noteParts[pitch] = partForNote(pitch, soundingNotes, splitPoint)
+				addToParts(noteParts[pitch], te)
+			}
+		}
+	}
+	return trackFromAbsoluteEvents(upperEvents), trackFromAbsoluteEvents(lowerEvents)
+}
+
+// Decides which part(s) a note belongs to, given every note sounding alongside it
+func partForNote(pitch uint8, soundingNotes map[uint8]bool, splitPoint int) int {
+	if splitPoint != SubSplitByChordPosition {
+		if int(pitch) >= splitPoint {
+			return upperPart
+		}
+		return lowerPart
+	}
+
+	if len(soundingNotes) == 1 {
+		return upperPart | lowerPart
+	}
+	for otherPitch := range soundingNotes {
+		if otherPitch > pitch {
+			return lowerPart
+		}
+	}
+	return upperPart
+}
+
+// Returns a copy of a Sequence/Track Name meta event with suffix appended to the name
+func renamedTrackNameEvent(e smf.Event, suffix string) smf.Event {
+	renamedEvent, err := smf.NewMetaEvent(e.GetDTime(), smf.MetaSequenceTrackName, append(append([]byte{}, e.GetData()...), suffix...))
+	if err != nil {
+		log.Fatalf("Failed to create new track name event with error: %v", err)
+	}
+	return renamedEvent
+}
@@ -0,0 +1,145 @@
+package midi
+
+import (
+	"log"
+	"math"
+	"sort"
+
+	"github.com/Try431/EasyMIDI/smf"
+)
+
+// the tempo every MIDI file starts at until a Set Tempo meta event says otherwise (120 bpm)
+const defaultMicrosecondsPerQuarter = uint32(500000)
+
+// tempoChange is a Set Tempo meta event
+type tempoChange struct {
+	tick                   uint32
+	microsecondsPerQuarter uint32
+}
+
+// tempoMap converts between a MIDI file's ticks and real time, going by its division and Set Tempo meta events
+type tempoMap struct {
+	ticksPerQuarter uint32
+	// SMPTE divisions count ticks per second instead, and ignore the tempo
+	smpteTicksPerSecond float64
+	changes             []tempoChange
+}
+
+// Collects the Set Tempo meta events from all tracks of a MIDI file
+func newTempoMap(midi *smf.MIDIFile) tempoMap {
+	division := midi.GetDivision()
+	if division.IsSMTPE() {
+		framesPerSecond := -float64(division.GetSMTPE())
+		if division.GetSMTPE() == smf.SMTPE29 {
+			framesPerSecond = 29.97
+		}
+		return tempoMap{smpteTicksPerSecond: framesPerSecond * float64(division.GetTicks())}
+	}
+
+	tm := tempoMap{ticksPerQuarter: uint32(division.GetTicks())}
+	for trackNum := uint16(0); trackNum < midi.GetTracksNum(); trackNum++ {
+		for _, te := range absoluteEvents(midi.GetTrack(trackNum)) {
+			if te.event.GetStatus() == smf.MetaStatus && te.event.GetMetaType() == smf.MetaSetTempo && len(te.event.GetData()) == 3 {
+				data := te.event.GetData()
+				tm.changes = append(tm.changes, tempoChange{tick: te.tick, microsecondsPerQuarter: uint32(data[0])<<16 | uint32(data[1])<<8 | uint32(data[2])})
+			}
+		}
+	}
+	sort.SliceStable(tm.changes, func(i, j int) bool { return tm.changes[i].tick < tm.changes[j].tick })
+	return tm
+}
+
+// Returns the real time (in microseconds) at which a tick is played
+func (tm tempoMap) tickToMicroseconds(tick uint32) float64 {
+	if tm.smpteTicksPerSecond > 0 {
+		return float64(tick) / tm.smpteTicksPerSecond * 1e6
+	}
+	microseconds := 0.0
+	segmentStart := uint32(0)
+	tempo := defaultMicrosecondsPerQuarter
+	for _, change := range tm.changes {
+		if change.tick >= tick {
+			break
+		}
+		microseconds += float64(change.tick-segmentStart) * float64(tempo) / float64(tm.ticksPerQuarter)
+		segmentStart = change.tick
+		tempo = change.microsecondsPerQuarter
+	}
+	return microseconds + float64(tick-segmentStart)*float64(tempo)/float64(tm.ticksPerQuarter)
+}
+
+// Returns the tick (rounded to the nearest one) that is played at a real time in microseconds
+func (tm tempoMap) microsecondsToTick(microseconds float64) uint32 {
+	if tm.smpteTicksPerSecond > 0 {
+		return uint32(math.Round(microseconds / 1e6 * tm.smpteTicksPerSecond))
+	}
+	segmentStartTick := uint32(0)
+	segmentStartMicroseconds := 0.0
+	tempo := defaultMicrosecondsPerQuarter
+	for _, change := range tm.changes {
+		changeMicroseconds := segmentStartMicroseconds + float64(change.tick-segmentStartTick)*float64(tempo)/float64(tm.ticksPerQuarter)
+		if changeMicroseconds > microseconds {
+			break
+		}
+		segmentStartTick = change.tick
+		segmentStartMicroseconds = changeMicroseconds
+		tempo = change.microsecondsPerQuarter
+	}
+	return segmentStartTick + uint32(math.Round((microseconds-segmentStartMicroseconds)*float64(tm.ticksPerQuarter)/float64(tempo)))
+}
+
+// Returns a tempo map at the output division that plays the same as tm - each tempo change lands at the output tick that's played
+// at the same real time
+func (tm tempoMap) atOutputDivision() tempoMap {
+	outputTempoMap := tempoMap{ticksPerQuarter: uint32(outputTicksPerQuarter)}
+	for _, change := range tm.changes {
+		tick := outputTempoMap.microsecondsToTick(tm.tickToMicroseconds(change.tick))
+		outputTempoMap.changes = append(outputTempoMap.changes, tempoChange{tick: tick, microsecondsPerQuarter: change.microsecondsPerQuarter})
+	}
+	return outputTempoMap
+}
+
+// Converts a MIDI file's timing to outputTicksPerQuarter through real time (as mergeMIDIFiles does), so the bar, beat and rest
+// lengths worked out at the output division fit every input - a file already at the output division is returned as is. An SMPTE
+// file's Set Tempo events never changed its timing, so they're replaced by a single one for the 120 bpm it's converted at
+func rescaleToOutputDivision(midi *smf.MIDIFile) *smf.MIDIFile {
+	division := midi.GetDivision()
+	if !division.IsSMTPE() && division.GetTicks() == outputTicksPerQuarter {
+		return midi
+	}
+
+	outputDivision, err := smf.NewDivision(outputTicksPerQuarter, smf.NOSMTPE)
+	if err != nil {
+		log.Fatalf("Failed to create new Division object with error: %v", err)
+	}
+	rescaledMIDIFile, err := smf.NewSMF(midi.GetFormat(), *outputDivision)
+	if err != nil {
+		log.Fatalf("Failed to create new MIDI object with error: %v", err)
+	}
+	fileTempoMap := newTempoMap(midi)
+	outputTempoMap := fileTempoMap.atOutputDivision()
+	for trackNum := uint16(0); trackNum < midi.GetTracksNum(); trackNum++ {
+		var rescaledEvents []timedEvent
+		if division.IsSMTPE() && trackNum == 0 {
+			rescaledEvents = append(rescaledEvents, timedEvent{tick: 0, event: newTempoEvent(defaultMicrosecondsPerQuarter)})
+		}
+		for _, te := range absoluteEvents(midi.GetTrack(trackNum)) {
+			if division.IsSMTPE() && te.event.GetStatus() == smf.MetaStatus && te.event.GetMetaType() == smf.MetaSetTempo {
+				continue
+			}
+			tick := outputTempoMap.microsecondsToTick(fileTempoMap.tickToMicroseconds(te.tick))
+			rescaledEvents = append(rescaledEvents, timedEvent{tick: tick, event: te.event})
+		}
+		rescaledMIDIFile.AddTrack(trackFromAbsoluteEvents(rescaledEvents))
+	}
+	return rescaledMIDIFile
+}
+
+// Creates a Set Tempo meta event with no delta time, to be positioned with an absolute tick
+func newTempoEvent(microsecondsPerQuarter uint32) smf.Event {
+	event, err := smf.NewMetaEvent(0, smf.MetaSetTempo, []byte{byte(microsecondsPerQuarter >> 16), byte(microsecondsPerQuarter >> 8), byte(microsecondsPerQuarter)})
+	if err != nil {
+		log.Fatalf("Failed to create Set Tempo event with error: %v", err)
+	}
+	return event
+}
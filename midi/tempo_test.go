@@ -0,0 +1,89 @@
+package midi
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Try431/EasyMIDI/smf"
+)
+
+func TestRescaleToOutputDivision(t *testing.T) {
+	tempo60 := []byte{0x0f, 0x42, 0x40}
+
+	tests := []struct {
+		name     string
+		ticks    uint16
+		smpte    int8
+		tracks   [][]timedEvent
+		expected [][]string
+	}{
+		{
+			name:     "output division",
+			ticks:    960,
+			tracks:   [][]timedEvent{testNote(0, 60, 100, 960, 480)},
+			expected: [][]string{{"960 on 0 [60 100]", "1440 off 0 [60 0]"}},
+		},
+		{
+			name:     "coarser division",
+			ticks:    480,
+			tracks:   [][]timedEvent{testNote(0, 60, 100, 480, 240)},
+			expected: [][]string{{"960 on 0 [60 100]", "1440 off 0 [60 0]"}},
+		},
+		{
+			name:  "tempo change",
+			ticks: 480,
+			tracks: [][]timedEvent{
+				{{tick: 960, event: testMetaEvent(t, smf.MetaSetTempo, tempo60)}},
+				testNote(0, 60, 100, 1440, 480),
+			},
+			expected: [][]string{
+				{"1920 meta 81 [15 66 64]"},
+				{"2880 on 0 [60 100]", "3840 off 0 [60 0]"},
+			},
+		},
+		{
+			// 25 frames of 40 ticks is 1000 ticks a second, so the note starts a second (two beats at 120 bpm) in
+			name:  "SMPTE",
+			ticks: 40,
+			smpte: smf.SMTPE25,
+			tracks: [][]timedEvent{
+				{{tick: 0, event: testMetaEvent(t, smf.MetaSetTempo, tempo60)}},
+				testNote(0, 60, 100, 1000, 500),
+			},
+			expected: [][]string{
+				{"0 meta 81 [7 161 32]"},
+				{"1920 on 0 [60 100]", "2880 off 0 [60 0]"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			division, err := smf.NewDivision(test.ticks, test.smpte)
+			if err != nil {
+				t.Fatal(err)
+			}
+			midi, err := smf.NewSMF(smf.Format1, *division)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, events := range test.tracks {
+				if err := midi.AddTrack(trackFromAbsoluteEvents(events)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			rescaled := rescaleToOutputDivision(midi)
+			if outputDivision := rescaled.GetDivision(); outputDivision.IsSMTPE() || outputDivision.GetTicks() != outputTicksPerQuarter {
+				t.Fatalf("expected %d ticks per quarter, got %+v", outputTicksPerQuarter, outputDivision)
+			}
+			if int(rescaled.GetTracksNum()) != len(test.expected) {
+				t.Fatalf("expected %d tracks, got %d", len(test.expected), rescaled.GetTracksNum())
+			}
+			for trackNum, expected := range test.expected {
+				if got := describeEvents(rescaled.GetTrack(uint16(trackNum))); !reflect.DeepEqual(got, expected) {
+					t.Errorf("track %d: expected %v, got %v", trackNum, expected, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package midi
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/Try431/EasyMIDI/smf"
+)
+
+// timeSignatureChange is a Time Signature meta event, with the denominator stored as a note value (e.g., 4 for a quarter note)
+type timeSignatureChange struct {
+	tick        uint32
+	numerator   uint32
+	denominator uint32
+}
+
+func (ts timeSignatureChange) barLength() uint32 {
+	return ts.numerator * uint32(outputTicksPerQuarter) * 4 / ts.denominator
+}
+
+// the shortest beat a Time Signature event can give, as the power of 2 it divides a whole note by (7: a 128th note)
+const maxTimeSignatureExponent = 7
+
+// timeSignatureMap lists every time signature change in a song, sorted by tick and always starting at tick 0
+type timeSignatureMap []timeSignatureChange
+
+// Collects the Time Signature meta events from all tracks - songs without one at the very start are assumed to start in 4/4
+func newTimeSignatureMap(tracks []*smf.Track) timeSignatureMap {
+	changes := make(map[uint32]timeSignatureChange)
+	changes[0] = timeSignatureChange{tick: 0, numerator: 4, denominator: 4}
+	for _, track := range tracks {
+		for _, te := range absoluteEvents(track) {
+			if !isTimeSignature(te.event) {
+				continue
+			}
+			// removeInvalidTimeSignatures has already warned about these
+			if !isValidTimeSignature(te.event) {
+				continue
+			}
+			data := te.event.GetData()
+			changes[te.tick] = timeSignatureChange{tick: te.tick, numerator: uint32(data[0]), denominator: uint32(1) << data[1]}
+		}
+	}
+
+	var tsMap timeSignatureMap
+	for _, ts := range changes {
+		tsMap = append(tsMap, ts)
+	}
+	sort.Slice(tsMap, func(i, j int) bool { return tsMap[i].tick < tsMap[j].tick })
+	return tsMap
+}
+
+func isTimeSignature(e smf.Event) bool {
+	return e.GetStatus() == smf.MetaStatus && e.GetMetaType() == smf.MetaTimeSignature && len(e.GetData()) >= 2
+}
+
+// A bar of no beats, or of beats too short to measure in ticks, has no length to count bars by
+func isValidTimeSignature(e smf.Event) bool {
+	data := e.GetData()
+	return data[0] > 0 && data[1] <= maxTimeSignatureExponent
+}
+
+// Returns the MIDI file without the Time Signature events that can't be counted in bars (e.g., from a file written by a buggy
+// program), warning about each - the bars are counted by the time signatures around them instead
+func removeInvalidTimeSignatures(midi *smf.MIDIFile) *smf.MIDIFile {
+	checkedMIDIFile, err := smf.NewSMF(midi.GetFormat(), midi.GetDivision())
+	if err != nil {
+		log.Fatalf("Failed to create new MIDI object with error: %v", err)
+	}
+	for trackNum := uint16(0); trackNum < midi.GetTracksNum(); trackNum++ {
+		track := midi.GetTrack(trackNum)
+		var keptEvents []timedEvent
+		removed := false
+		for _, te := range absoluteEvents(track) {
+			if isTimeSignature(te.event) && !isValidTimeSignature(te.event) {
+				data := te.event.GetData()
+				fmt.Fprintf(os.Stderr, "Skipping the time signature at tick %d of track %d - %d beats of a note 1/2^%d long can't be counted in bars\n", te.tick, trackNum, data[0], data[1])
+				removed = true
+				continue
+			}
+			keptEvents = append(keptEvents, te)
+		}
+		if removed {
+			track = trackFromAbsoluteEvents(keptEvents)
+		}
+		checkedMIDIFile.AddTrack(track)
+	}
+	return checkedMIDIFile
+}
+
+// Returns the number of bars in the time signature segment at index i - a change that doesn't land on a
+// bar line is treated as starting a new bar
+func (tsMap timeSignatureMap) barsInSegment(i int) (int, bool) {
+	if i+1 >= len(tsMap) {
+		return 0, false
+	}
+	barLength := tsMap[i].barLength()
+	return int((tsMap[i+1].tick - tsMap[i].tick + barLength - 1) / barLength), true
+}
+
+// Returns the tick at which a (1-based) bar number starts
+func (tsMap timeSignatureMap) barStartTick(bar int) uint32 {
+	firstBarOfSegment := 1
+	for i, ts := range tsMap {
+		bars, bounded := tsMap.barsInSegment(i)
+		if !bounded || bar < firstBarOfSegment+bars {
+			return ts.tick + uint32(bar-firstBarOfSegment)*ts.barLength()
+		}
+		firstBarOfSegment += bars
+	}
+	return 0
+}
+
+// Returns the (1-based) number of the bar that a tick falls in
+func (tsMap timeSignatureMap) barAt(tick uint32) int {
+	firstBarOfSegment := 1
+	for i, ts := range tsMap {
+		bars, bounded := tsMap.barsInSegment(i)
+		if !bounded || tick < tsMap[i+1].tick {
+			return firstBarOfSegment + int((tick-ts.tick)/ts.barLength())
+		}
+		firstBarOfSegment += bars
+	}
+	return 0
+}
+
+// Returns the number of bars in a song that ends at songEnd - an end that lands on a bar line doesn't start another bar
+func (tsMap timeSignatureMap) barCount(songEnd uint32) int {
+	if songEnd == 0 {
+		return 0
+	}
+	return tsMap.barAt(songEnd - 1)
+}
+
+// Returns the length (in ticks) of the bar that a tick falls in
+func (tsMap timeSignatureMap) barLengthAt(tick uint32) uint32 {
+	return tsMap.timeSignatureAt(tick).barLength()
+}
+
+// Returns the length (in ticks) of a beat at tick, going by the denominator of the time signature in force
+func (tsMap timeSignatureMap) beatLengthAt(tick uint32) uint32 {
+	return tsMap.timeSignatureAt(tick).barLength() / tsMap.timeSignatureAt(tick).numerator
+}
+
+// Returns the time signature in force at tick
+func (tsMap timeSignatureMap) timeSignatureAt(tick uint32) timeSignatureChange {
+	current := tsMap[0]
+	for _, ts := range tsMap {
+		if ts.tick > tick {
+			break
+		}
+		current = ts
+	}
+	return current
+}
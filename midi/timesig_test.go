@@ -0,0 +1,116 @@
+package midi
+
+import (
+	"testing"
+
+	"github.com/Try431/EasyMIDI/smf"
+)
+
+// Returns a Time Signature event for numerator beats of a note 1/2^exponent long, to be positioned with an absolute tick
+func testTimeSignature(t *testing.T, numerator uint8, exponent uint8) smf.Event {
+	return testMetaEvent(t, smf.MetaTimeSignature, []byte{numerator, exponent, 24, 8})
+}
+
+func TestInvalidTimeSignatures(t *testing.T) {
+	header := trackFromAbsoluteEvents([]timedEvent{
+		{tick: 0, event: testTimeSignature(t, 3, 2)},
+		{tick: 2880, event: testTimeSignature(t, 0, 2)},
+		{tick: 5760, event: testTimeSignature(t, 4, 32)},
+	})
+	midi := removeInvalidTimeSignatures(newTestMIDI(t, outputTicksPerQuarter, header))
+
+	tracks := []*smf.Track{midi.GetTrack(0)}
+	if got := len(describeEvents(tracks[0])); got != 1 {
+		t.Errorf("%d time signatures left, want only the 3/4 one", got)
+	}
+	// the bars go on in 3/4, rather than dividing by a bar length of 0
+	if tick := newTimeSignatureMap(tracks).barStartTick(4); tick != 3*2880 {
+		t.Errorf("bar 4 starts at tick %d, want %d", tick, 3*2880)
+	}
+	// even without removing them first, bars are never measured by them
+	if tick := newTimeSignatureMap([]*smf.Track{header}).barStartTick(4); tick != 3*2880 {
+		t.Errorf("bar 4 starts at tick %d, want %d", tick, 3*2880)
+	}
+}
+
+func TestBarCount(t *testing.T) {
+	// a bar of 4/4, then bars of 3/4 - 3840 ticks, then 2880 ticks each
+	tsMap := newTimeSignatureMap([]*smf.Track{trackFromAbsoluteEvents([]timedEvent{{tick: 3840, event: testTimeSignature(t, 3, 2)}})})
+
+	tests := []struct {
+		songEnd  uint32
+		expected int
+	}{
+		{songEnd: 0, expected: 0},
+		{songEnd: 1, expected: 1},
+		{songEnd: 3840, expected: 1},
+		{songEnd: 3841, expected: 2},
+		{songEnd: 3840 + 2*2880, expected: 3},
+		{songEnd: 3840 + 2*2880 + 1, expected: 4},
+	}
+	for _, test := range tests {
+		if got := tsMap.barCount(test.songEnd); got != test.expected {
+			t.Errorf("a song ending at tick %d has %d bars, want %d", test.songEnd, got, test.expected)
+		}
+	}
+}
+
+func TestBarStartTick(t *testing.T) {
+	tests := []struct {
+		name           string
+		timeSignatures []timedEvent
+		bar            int
+		want           uint32
+	}{
+		{name: "no time signature", bar: 3, want: 2 * 3840},
+		{
+			name:           "3/4",
+			timeSignatures: []timedEvent{{tick: 0, event: testTimeSignature(t, 3, 2)}},
+			bar:            3,
+			want:           2 * 2880,
+		},
+		{
+			name:           "before a change",
+			timeSignatures: []timedEvent{{tick: 2 * 3840, event: testTimeSignature(t, 6, 3)}},
+			bar:            2,
+			want:           3840,
+		},
+		{
+			name:           "at a change",
+			timeSignatures: []timedEvent{{tick: 2 * 3840, event: testTimeSignature(t, 6, 3)}},
+			bar:            3,
+			want:           2 * 3840,
+		},
+		{
+			name:           "after a change",
+			timeSignatures: []timedEvent{{tick: 2 * 3840, event: testTimeSignature(t, 6, 3)}},
+			bar:            5,
+			want:           2*3840 + 2*2880,
+		},
+		{
+			name: "after several changes",
+			timeSignatures: []timedEvent{
+				{tick: 0, event: testTimeSignature(t, 3, 2)},
+				{tick: 2880, event: testTimeSignature(t, 2, 2)},
+				{tick: 2880 + 2*1920, event: testTimeSignature(t, 4, 2)},
+			},
+			bar:  5,
+			want: 2880 + 2*1920 + 3840,
+		},
+		{
+			// the change halfway through the second bar starts the third
+			name:           "a change off the bar line",
+			timeSignatures: []timedEvent{{tick: 3840 + 1920, event: testTimeSignature(t, 3, 2)}},
+			bar:            4,
+			want:           3840 + 1920 + 2880,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tsMap := newTimeSignatureMap([]*smf.Track{trackFromAbsoluteEvents(test.timeSignatures)})
+			if got := tsMap.barStartTick(test.bar); got != test.want {
+				t.Errorf("bar %d starts at tick %d, want %d", test.bar, got, test.want)
+			}
+		})
+	}
+}
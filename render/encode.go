@@ -0,0 +1,116 @@
+package render
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Try431/MIDI-part-splitter/audio"
+)
+
+// Format is an audio file format a Renderer can write
+type Format string
+
+// the formats audio files can be written in - every format but WAV is encoded with the ffmpeg command
+const (
+	FormatWAV  = Format("wav")
+	FormatFLAC = Format("flac")
+	FormatOgg  = Format("ogg")
+	FormatOpus = Format("opus")
+	FormatM4A  = Format("m4a")
+	FormatMP3  = Format("mp3")
+)
+
+// the bitrate (in kbit/s) MP3 files are encoded at when no bitrate or quality is given
+const defaultMP3Bitrate = 320
+
+// formatNames maps every name a format can be given by to the format
+var formatNames = map[string]Format{
+	"wav":    FormatWAV,
+	"flac":   FormatFLAC,
+	"ogg":    FormatOgg,
+	"vorbis": FormatOgg,
+	"opus":   FormatOpus,
+	"m4a":    FormatM4A,
+	"aac":    FormatM4A,
+	"mp3":    FormatMP3,
+}
+
+// ParseFormat returns the format with the given name - 'vorbis' and 'aac' are accepted for ogg and m4a
+func ParseFormat(name string) (Format, error) {
+	if format, ok := formatNames[strings.ToLower(name)]; ok {
+		return format, nil
+	}
+	return "", fmt.Errorf("render: unknown audio format %q", name)
+}
+
+// Extension returns the file extension of the format, including the dot
+func (f Format) Extension() string {
+	return "." + string(f)
+}
+
+// Returns the ffmpeg arguments choosing the encoder of a format, along with its bitrate or VBR quality - formats without one
+// ignore them
+func (f Format) encoderArgs(bitrate int, quality float64) []string {
+	var args []string
+	switch f {
+	case FormatFLAC:
+		return []string{"-c:a", "flac"}
+	case FormatOgg:
+		args = []string{"-c:a", "libvorbis"}
+	case FormatOpus:
+		// Opus has no quality scale of its own, only a bitrate it varies around
+		args = []string{"-c:a", "libopus", "-vbr", "on"}
+		quality = -1
+	case FormatM4A:
+		args = []string{"-c:a", "aac"}
+	case FormatMP3:
+		args = []string{"-c:a", "libmp3lame"}
+		if bitrate <= 0 && quality < 0 {
+			bitrate = defaultMP3Bitrate
+		}
+	}
+	if quality >= 0 {
+		return append(args, "-q:a", strconv.FormatFloat(quality, 'f', -1, 64))
+	}
+	if bitrate > 0 {
+		return append(args, "-b:a", strconv.Itoa(bitrate)+"k")
+	}
+	return args
+}
+
+// Writes a rendered buffer to outputDir as an audio file named after the MIDI file, in the format the config asks for (or
+// defaultFormat when it doesn't ask for one)
+func encodeAudioFile(buffer *audio.Buffer, midiPath string, outputDir string, config Config, defaultFormat Format) (*Result, error) {
+	format := config.Format
+	if format == "" {
+		format = defaultFormat
+	}
+	if err := os.MkdirAll(outputDir, os.ModePerm); err != nil {
+		return nil, &Error{Op: "create output directory", Path: outputDir, Err: err}
+	}
+
+	// only the extension is dropped, so names and directories with dots in them are kept whole
+	baseName := strings.TrimSuffix(filepath.Base(midiPath), filepath.Ext(midiPath))
+	audioPath := filepath.Join(outputDir, baseName+format.Extension())
+	if format == FormatWAV {
+		if err := audio.WriteWAVFile(audioPath, buffer); err != nil {
+			return nil, &Error{Op: "write WAV file", Path: audioPath, Err: err}
+		}
+		return &Result{MIDIPath: midiPath, AudioPath: audioPath}, nil
+	}
+
+	// ffmpeg reads the audio from a temporary WAV file written next to the file it creates
+	wavPath := filepath.Join(outputDir, baseName+".tmp.wav")
+	defer os.Remove(wavPath)
+	if err := audio.WriteWAVFile(wavPath, buffer); err != nil {
+		return nil, &Error{Op: "write WAV file", Path: wavPath, Err: err}
+	}
+	args := append([]string{"-y", "-i", wavPath, "-vn"}, format.encoderArgs(config.Bitrate, config.Quality)...)
+	if err := runCommand("ffmpeg", append(args, audioPath)...); err != nil {
+		return nil, &Error{Op: "ffmpeg", Path: wavPath, Err: err}
+	}
+	return &Result{MIDIPath: midiPath, AudioPath: audioPath}, nil
+}
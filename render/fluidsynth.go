@@ -0,0 +1,86 @@
+package render
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Try431/EasyMIDI/smf"
+	"github.com/Try431/EasyMIDI/smfio"
+	"github.com/Try431/MIDI-part-splitter/audio"
+)
+
+// FluidSynth renders MIDI files with the fluidsynth command and encodes them with the ffmpeg command (unless they're written as
+// WAV files) - both have to be installed and on the PATH
+type FluidSynth struct {
+	Config
+}
+
+// NewFluidSynth creates a FluidSynth renderer with the given settings
+func NewFluidSynth(config Config) *FluidSynth {
+	return &FluidSynth{Config: config}
+}
+
+// Render renders the job's MIDI file to an audio file of the same name in outputDir - an MP3 file unless the config asks for
+// another format
+func (f *FluidSynth) Render(job Job, outputDir string) (*Result, error) {
+	return renderJob(f, job, outputDir, f.Config, FormatMP3)
+}
+
+// Plays a MIDI file with fluidsynth - it's written to a temporary directory for fluidsynth to read, along with the WAV file
+// fluidsynth creates
+func (f *FluidSynth) synthesize(midi *smf.MIDIFile, soundFont string) (*audio.Buffer, error) {
+	if _, err := os.Stat(soundFont); err != nil {
+		return nil, &Error{Op: "open soundfont", Path: soundFont, Err: err}
+	}
+	tempDir, err := ioutil.TempDir("", "midi-part-splitter")
+	if err != nil {
+		return nil, &Error{Op: "create temporary directory", Path: os.TempDir(), Err: err}
+	}
+	defer os.RemoveAll(tempDir)
+
+	midiPath := filepath.Join(tempDir, "song.mid")
+	wavPath := filepath.Join(tempDir, "song.wav")
+	if err := writeMIDIFile(midiPath, midi); err != nil {
+		return nil, &Error{Op: "write MIDI file", Path: midiPath, Err: err}
+	}
+	if err := runCommand("fluidsynth", "-F", wavPath, "-r", strconv.Itoa(f.SampleRate), soundFont, midiPath); err != nil {
+		return nil, &Error{Op: "fluidsynth", Path: midiPath, Err: err}
+	}
+	buffer, err := audio.ReadWAVFile(wavPath)
+	if err != nil {
+		return nil, &Error{Op: "read WAV file", Path: wavPath, Err: err}
+	}
+	return buffer, nil
+}
+
+func writeMIDIFile(midiPath string, midi *smf.MIDIFile) error {
+	file, err := os.Create(midiPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	if err := smfio.Write(writer, midi); err != nil {
+		return err
+	}
+	return writer.Flush()
+}
+
+// Runs a command, adding the last line it printed (usually the reason it failed) to the error when it fails
+func runCommand(name string, args ...string) error {
+	output, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		if lines := strings.Split(strings.TrimSpace(string(output)), "\n"); lines[len(lines)-1] != "" {
+			return fmt.Errorf("%v: %v", err, lines[len(lines)-1])
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package render
+
+import (
+	"github.com/Try431/EasyMIDI/smf"
+	"github.com/Try431/MIDI-part-splitter/audio"
+	"github.com/Try431/MIDI-part-splitter/synth"
+)
+
+// Native renders MIDI files with the built-in SoundFont synthesizer - WAV files are written without any other programs, while
+// the other formats are encoded with the ffmpeg command
+type Native struct {
+	Config
+}
+
+// NewNative creates a Native renderer with the given settings
+func NewNative(config Config) *Native {
+	return &Native{Config: config}
+}
+
+// Render renders the job's MIDI file to an audio file of the same name in outputDir - a WAV file unless the config asks for
+// another format
+func (n *Native) Render(job Job, outputDir string) (*Result, error) {
+	return renderJob(n, job, outputDir, n.Config, FormatWAV)
+}
+
+// Plays a MIDI file with the built-in synthesizer
+func (n *Native) synthesize(midi *smf.MIDIFile, soundFont string) (*audio.Buffer, error) {
+	loadedSoundFont, err := LoadSoundFont(soundFont)
+	if err != nil {
+		return nil, err
+	}
+	return synth.New(loadedSoundFont, n.SampleRate).Render(midi), nil
+}
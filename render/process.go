@@ -0,0 +1,62 @@
+package render
+
+import (
+	"github.com/Try431/MIDI-part-splitter/audio"
+)
+
+// LoudnessReport is the loudness of an audio file before and after it was normalized
+type LoudnessReport struct {
+	Measured   audio.Loudness
+	Normalized audio.Loudness
+}
+
+// Renders a job with a synthesizer and writes it out as an audio file - defaultFormat is used when the config doesn't ask for a
+// format
+func renderJob(s synthesizer, job Job, outputDir string, config Config, defaultFormat Format) (*Result, error) {
+	buffer, err := synthesizeJob(s, job, config)
+	if config.TrimThreshold != 0 {
+		// an output that failed still has to report to its song, or the other outputs would wait for it forever
+		start, end, sounding := 0, 0, false
+		if err == nil {
+			start, end, sounding = audio.SoundingRange(buffer, config.TrimThreshold)
+		}
+		if job.Song != nil {
+			start, end, sounding = job.Song.alignSoundingRange(start, end, sounding)
+		}
+		if err == nil && sounding {
+			buffer = buffer.Slice(start, end)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	buffer, loudness := processAudio(buffer, config)
+	result, err := encodeAudioFile(buffer, job.MIDIPath, outputDir, config, defaultFormat)
+	if err != nil {
+		return nil, err
+	}
+	result.Loudness = loudness
+	return result, nil
+}
+
+// Gets a (trimmed) rendered buffer ready to be written out - its channels are changed to the ones the config asks for, it's
+// faded in and out and padded, and it's normalized when the config sets a loudness target (the report is nil otherwise)
+func processAudio(buffer *audio.Buffer, config Config) (*audio.Buffer, *LoudnessReport) {
+	if config.Channels > 0 {
+		buffer = buffer.WithChannels(config.Channels)
+	}
+	audio.FadeIn(buffer, secondsToFrames(config.FadeIn, buffer.SampleRate))
+	audio.FadeOut(buffer, secondsToFrames(config.FadeOut, buffer.SampleRate))
+	if padding := secondsToFrames(config.Padding, buffer.SampleRate); padding > 0 {
+		buffer = buffer.Padded(padding, padding)
+	}
+	if config.LoudnessTarget == 0 {
+		return buffer, nil
+	}
+	measured, normalized := audio.Normalize(buffer, config.LoudnessTarget, config.TruePeakLimit)
+	return buffer, &LoudnessReport{Measured: measured, Normalized: normalized}
+}
+
+func secondsToFrames(seconds float64, sampleRate int) int {
+	return int(seconds*float64(sampleRate) + 0.5)
+}
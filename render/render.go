@@ -0,0 +1,96 @@
+// Package render turns the MIDI files written by the splitter into audio files
+package render
+
+import (
+	"fmt"
+
+	"github.com/Try431/MIDI-part-splitter/audio"
+	"github.com/Try431/MIDI-part-splitter/synth"
+)
+
+// Renderer renders a MIDI file to an audio file in outputDir, named after the MIDI file
+type Renderer interface {
+	Render(job Job, outputDir string) (*Result, error)
+}
+
+// Job is a MIDI file to be rendered
+type Job struct {
+	// MIDIPath the MIDI file to render
+	MIDIPath string
+	// LeadTrack the track (counting from 0) holding the emphasized part, or -1 if the file doesn't have one
+	LeadTrack int
+	// Song the set of outputs the MIDI file plays along with - the jobs of a set should share one, so each version of a part
+	// is only rendered once and every output is trimmed alike (default nil: the job is rendered on its own)
+	Song *Song
+}
+
+// Config holds the settings shared by every renderer
+type Config struct {
+	// SoundFont the .sf2 file the MIDI files are played with
+	SoundFont string
+	// LeadSoundFont the .sf2 file the emphasized part is played with instead - it's rendered separately and mixed with the
+	// rest of the song (default "": the emphasized part is played with SoundFont too)
+	LeadSoundFont string
+	// Format the format of the audio files (default "": the renderer's own format)
+	Format Format
+	// SampleRate the sample rate the MIDI files are rendered at
+	SampleRate int
+	// Channels the number of channels in the audio files - 1 (mono) or 2 (stereo)
+	Channels int
+	// Bitrate the bitrate (in kbit/s) of lossy formats (default 0: 320 for MP3 and the encoder's own for the others)
+	Bitrate int
+	// Quality the VBR quality of lossy formats, on the encoder's own scale - used instead of Bitrate when it's set
+	// (default -1: no VBR quality)
+	Quality float64
+	// LoudnessTarget the integrated loudness (in LUFS) every audio file is normalized to (default 0: not normalized)
+	LoudnessTarget float64
+	// TruePeakLimit the highest true peak (in dBTP) a normalized audio file may reach - louder peaks are limited
+	TruePeakLimit float64
+	// TrimThreshold the level (in dBFS) below which the start and end of the audio files count as silence and are trimmed -
+	// every output of a song is trimmed to the same frames (default 0: nothing is trimmed)
+	TrimThreshold float64
+	// Padding the seconds of silence added to the start and end of the audio files
+	Padding float64
+	// FadeIn the length (in seconds) of the fade in at the start of the audio files, before any padding
+	FadeIn float64
+	// FadeOut the length (in seconds) of the fade out at the end of the audio files, before any padding
+	FadeOut float64
+	// EmphasizedEffects the effects the emphasized part's stem is run through before it's mixed
+	EmphasizedEffects []audio.Effect
+	// BackgroundEffects the effects the stems of the other parts are run through before they're mixed
+	BackgroundEffects []audio.Effect
+}
+
+// DefaultConfig returns the settings renderers use unless they're told otherwise
+func DefaultConfig() Config {
+	return Config{SoundFont: DefaultSoundFont(), SampleRate: synth.DefaultSampleRate, Channels: 2, Quality: -1, TruePeakLimit: -1}
+}
+
+// Result describes an audio file created by a Renderer
+type Result struct {
+	// MIDIPath the MIDI file that was rendered
+	MIDIPath string
+	// AudioPath the audio file that was created
+	AudioPath string
+	// Loudness the loudness of the audio file before and after it was normalized (nil when it wasn't)
+	Loudness *LoudnessReport
+}
+
+// Error is returned by a Renderer when one of the steps of rendering a file fails
+type Error struct {
+	// Op the step that failed (e.g., "fluidsynth")
+	Op string
+	// Path the file the step was working on
+	Path string
+	// Err the underlying error
+	Err error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("render: %v %v: %v", e.Op, e.Path, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,51 @@
+package render
+
+import (
+	"sync"
+)
+
+// Song is shared by the jobs rendering one set of outputs that play together (e.g., the parts of a song, or of one section of
+// it) - they share the stems they're mixed from, and when silence is trimmed, each output waits for the rest so they're all
+// trimmed to the same frames and stay in time with each other. The jobs of a song have to be rendered at the same time when
+// trimming
+type Song struct {
+	stems *stemCache
+
+	lock    sync.Mutex
+	outputs int
+	// the number of outputs that have reported the frames they sound between
+	reported int
+	start    int
+	end      int
+	sounding bool
+	// closed once every output has reported
+	aligned chan struct{}
+}
+
+// NewSong creates a song with outputs outputs to be rendered
+func NewSong(outputs int) *Song {
+	return &Song{stems: newStemCache(), outputs: outputs, aligned: make(chan struct{})}
+}
+
+// Reports the frames an output sounds between (sounding is false for an output that's silent or failed to render), and waits
+// for every other output of the song to do the same - returns the frames any output of the song sounds between
+func (s *Song) alignSoundingRange(start int, end int, sounding bool) (int, int, bool) {
+	s.lock.Lock()
+	if sounding {
+		if !s.sounding || start < s.start {
+			s.start = start
+		}
+		if !s.sounding || end > s.end {
+			s.end = end
+		}
+		s.sounding = true
+	}
+	s.reported++
+	if s.reported == s.outputs {
+		close(s.aligned)
+	}
+	s.lock.Unlock()
+
+	<-s.aligned
+	return s.start, s.end, s.sounding
+}
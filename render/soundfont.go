@@ -0,0 +1,46 @@
+package render
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/Try431/MIDI-part-splitter/sf2"
+)
+
+// defaultSoundFont the soundfont shipped with the splitter, relative to the directory of the executable or the working directory
+var defaultSoundFont = filepath.Join("convert", "FluidR3_GM.sf2")
+
+// soundfonts are large, so each one is only read once, however many files are rendered with it
+var loadedSoundFonts = make(map[string]*sf2.SoundFont)
+var loadedSoundFontsLock sync.Mutex
+
+// DefaultSoundFont returns the path of the soundfont shipped with the splitter - it's looked for next to the executable first,
+// so the splitter can be run from any directory, and then in the working directory (e.g., when using go run)
+func DefaultSoundFont() string {
+	if executable, err := os.Executable(); err == nil {
+		if resolved, err := filepath.EvalSymlinks(executable); err == nil {
+			executable = resolved
+		}
+		soundFont := filepath.Join(filepath.Dir(executable), defaultSoundFont)
+		if _, err := os.Stat(soundFont); err == nil {
+			return soundFont
+		}
+	}
+	return defaultSoundFont
+}
+
+// LoadSoundFont reads and parses the soundfont at path, or returns it straight away if it's already been loaded
+func LoadSoundFont(path string) (*sf2.SoundFont, error) {
+	loadedSoundFontsLock.Lock()
+	defer loadedSoundFontsLock.Unlock()
+	if soundFont, ok := loadedSoundFonts[path]; ok {
+		return soundFont, nil
+	}
+	soundFont, err := sf2.Open(path)
+	if err != nil {
+		return nil, &Error{Op: "open soundfont", Path: path, Err: err}
+	}
+	loadedSoundFonts[path] = soundFont
+	return soundFont, nil
+}
@@ -0,0 +1,303 @@
+package render
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"sync"
+
+	"github.com/Try431/EasyMIDI/smf"
+	"github.com/Try431/EasyMIDI/smfio"
+	"github.com/Try431/MIDI-part-splitter/audio"
+)
+
+// 0x07 and 0x0A are the codes for control change numbers for a channel's volume and pan
+const (
+	volumeController = uint8(0x07)
+	panController    = uint8(0x0A)
+	maxControlValue  = 127
+	centerPanValue   = 64
+)
+
+// synthesizer plays a MIDI file with a soundfont
+type synthesizer interface {
+	synthesize(midi *smf.MIDIFile, soundFont string) (*audio.Buffer, error)
+}
+
+// stemCache holds the stems rendered for the outputs of one song - the outputs only differ in the volume, pan and instrument
+// of each part, so each version of a part is rendered once and every output is mixed from the stems. The stems are kept in
+// memory until the cache is dropped, so a new cache is used for each song
+type stemCache struct {
+	lock  sync.Mutex
+	stems map[string]*cachedStem
+}
+
+// cachedStem is a stem that has been (or is being) rendered - done is closed once buffer and err are set
+type cachedStem struct {
+	done   chan struct{}
+	buffer *audio.Buffer
+	err    error
+}
+
+func newStemCache() *stemCache {
+	return &stemCache{stems: make(map[string]*cachedStem)}
+}
+
+// Returns the stem stored under key, synthesizing it first if no other output has - outputs rendered at the same time wait
+// for the one rendering the stem instead of rendering it again
+func (c *stemCache) get(key string, synthesize func() (*audio.Buffer, error)) (*audio.Buffer, error) {
+	c.lock.Lock()
+	stem, ok := c.stems[key]
+	if !ok {
+		stem = &cachedStem{done: make(chan struct{})}
+		c.stems[key] = stem
+	}
+	c.lock.Unlock()
+
+	if ok {
+		<-stem.done
+	} else {
+		stem.buffer, stem.err = synthesize()
+		close(stem.done)
+	}
+	return stem.buffer, stem.err
+}
+
+// stem is one channel of a MIDI file (with the file's header tracks, so it keeps the song's tempo), ready to be synthesized
+// on its own and mixed with the other channels
+type stem struct {
+	midi      *smf.MIDIFile
+	soundFont string
+	// the stem is the emphasized part's channel
+	lead bool
+	// the volume and pan the channel is set to before its first note, taken out of the MIDI file so they can be applied when
+	// mixing - versions of a part that only differ in volume or pan then share a stem
+	gain float64
+	pan  float64
+}
+
+// Renders a job's MIDI file to audio by synthesizing each of its channels as a stem (or taking it from the stems of the job's song)
+// and mixing the stems - when there's a lead soundfont, the emphasized part's channel is synthesized with it, and each stem is
+// run through the effects of its role before it's mixed
+func synthesizeJob(s synthesizer, job Job, config Config) (*audio.Buffer, error) {
+	midi, err := readMIDIFile(job.MIDIPath)
+	if err != nil {
+		return nil, &Error{Op: "read MIDI file", Path: job.MIDIPath, Err: err}
+	}
+	stems, err := splitStems(midi, job.LeadTrack, config)
+	if err != nil {
+		return nil, &Error{Op: "split stems", Path: job.MIDIPath, Err: err}
+	}
+
+	cache := newStemCache()
+	if job.Song != nil {
+		cache = job.Song.stems
+	}
+	parts := make([]audio.Part, len(stems))
+	for i, st := range stems {
+		key, err := stemKey(st)
+		if err != nil {
+			return nil, &Error{Op: "split stems", Path: job.MIDIPath, Err: err}
+		}
+		buffer, err := cache.get(key, func() (*audio.Buffer, error) { return s.synthesize(st.midi, st.soundFont) })
+		if err != nil {
+			return nil, err
+		}
+		// the effects are run on a copy, which is cached too, so the plain stem stays as it was for outputs that need it in
+		// another role
+		effects, role := config.BackgroundEffects, "background"
+		if st.lead {
+			effects, role = config.EmphasizedEffects, "emphasized"
+		}
+		if len(effects) > 0 {
+			stemBuffer := buffer
+			buffer, err = cache.get(key+role, func() (*audio.Buffer, error) {
+				return audio.ApplyEffects(stemBuffer.Copy(), effects), nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		parts[i] = audio.Part{Buffer: buffer, Gain: st.gain, Pan: st.pan}
+	}
+	return audio.Mix(parts...), nil
+}
+
+// Splits a MIDI file into one stem per channel, each holding every track on that channel (e.g., a part and its octave
+// doubling) along with the header tracks - a file that has no channels, or a track using more than one, can't be split and
+// is returned as a single stem
+func splitStems(midi *smf.MIDIFile, leadTrack int, config Config) ([]stem, error) {
+	var headerTracks []*smf.Track
+	var channels []uint8
+	channelTracks := make(map[uint8][]*smf.Track)
+	leadChannel := -1
+	for trackNum := uint16(0); trackNum < midi.GetTracksNum(); trackNum++ {
+		track := midi.GetTrack(trackNum)
+		trackChannels := channelsOf(track)
+		if len(trackChannels) > 1 {
+			return []stem{{midi: midi, soundFont: config.SoundFont, gain: 1}}, nil
+		}
+		if len(trackChannels) == 0 {
+			headerTracks = append(headerTracks, track)
+			continue
+		}
+		channel := trackChannels[0]
+		if _, ok := channelTracks[channel]; !ok {
+			channels = append(channels, channel)
+		}
+		channelTracks[channel] = append(channelTracks[channel], track)
+		if int(trackNum) == leadTrack {
+			leadChannel = int(channel)
+		}
+	}
+	if len(channels) == 0 {
+		return []stem{{midi: midi, soundFont: config.SoundFont, gain: 1}}, nil
+	}
+
+	var stems []stem
+	for _, channel := range channels {
+		stemMIDI, err := smf.NewSMF(smf.Format1, midi.GetDivision())
+		if err != nil {
+			return nil, err
+		}
+		for _, track := range headerTracks {
+			stemMIDI.AddTrack(track)
+		}
+		tracks, gain, pan, err := liftStaticMix(channelTracks[channel])
+		if err != nil {
+			return nil, err
+		}
+		for _, track := range tracks {
+			stemMIDI.AddTrack(track)
+		}
+
+		soundFont := config.SoundFont
+		if config.LeadSoundFont != "" && int(channel) == leadChannel {
+			soundFont = config.LeadSoundFont
+		}
+		stems = append(stems, stem{midi: stemMIDI, soundFont: soundFont, lead: int(channel) == leadChannel, gain: gain, pan: pan})
+	}
+	return stems, nil
+}
+
+// controllerSetting is the value a controller is set to before a channel's first note
+type controllerSetting struct {
+	tick  uint32
+	value uint8
+	set   bool
+	// the controller isn't changed once the channel is playing
+	static bool
+}
+
+// Takes the volume and pan a channel is set to before its first note out of its tracks, returning the tracks with the volume
+// set to full and the pan centred, along with the gain and pan that set them back when mixing. A volume or pan that changes
+// once the channel is playing is left in the tracks, with a gain of 1 or a pan of 0
+func liftStaticMix(tracks []*smf.Track) ([]*smf.Track, float64, float64, error) {
+	firstNoteTick := ^uint32(0)
+	for _, track := range tracks {
+		tick := uint32(0)
+		for _, e := range track.GetAllEvents() {
+			tick += e.GetDTime()
+			if e.GetStatus() == smf.NoteOnStatus && e.GetData()[1] > 0 && tick < firstNoteTick {
+				firstNoteTick = tick
+			}
+		}
+	}
+
+	// the last setting before the first note is the one the channel plays at, and a later setting rules the controller out
+	settings := map[uint8]*controllerSetting{volumeController: {static: true}, panController: {static: true}}
+	for _, track := range tracks {
+		tick := uint32(0)
+		for _, e := range track.GetAllEvents() {
+			tick += e.GetDTime()
+			if e.GetStatus() != smf.ControllerChangeStatus {
+				continue
+			}
+			setting, ok := settings[e.GetData()[0]]
+			if !ok {
+				continue
+			}
+			if tick > firstNoteTick {
+				setting.static = false
+			} else if !setting.set || tick >= setting.tick {
+				setting.tick, setting.value, setting.set = tick, e.GetData()[1], true
+			}
+		}
+	}
+
+	gain, pan := 1.0, 0.0
+	neutralValues := make(map[uint8]uint8)
+	if volume := settings[volumeController]; volume.static && volume.set {
+		gain = float64(volume.value) / maxControlValue
+		// General MIDI volume follows the square of the controller value
+		gain *= gain
+		neutralValues[volumeController] = maxControlValue
+	}
+	if p := settings[panController]; p.static && p.set {
+		pan = (float64(p.value) - centerPanValue) / centerPanValue
+		neutralValues[panController] = centerPanValue
+	}
+	if len(neutralValues) == 0 {
+		return tracks, gain, pan, nil
+	}
+
+	neutralTracks := make([]*smf.Track, len(tracks))
+	for i, track := range tracks {
+		events := track.GetAllEvents()
+		for j, e := range events {
+			if e.GetStatus() != smf.ControllerChangeStatus {
+				continue
+			}
+			if value, ok := neutralValues[e.GetData()[0]]; ok {
+				event, err := smf.NewMIDIEvent(e.GetDTime(), e.GetStatus(), e.GetChannel(), e.GetData()[0], value)
+				if err != nil {
+					return nil, 0, 0, err
+				}
+				events[j] = event
+			}
+		}
+		neutralTrack, err := smf.TrackFromArray(events)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		neutralTracks[i] = neutralTrack
+	}
+	return neutralTracks, gain, pan, nil
+}
+
+// Returns the channels used by the MIDI events in a track, in the order they first appear - header tracks, which only hold
+// meta and sysex events, have none
+func channelsOf(track *smf.Track) []uint8 {
+	var channels []uint8
+	seen := make(map[uint8]bool)
+	for _, e := range track.GetAllEvents() {
+		if smf.CheckMIDIStatus(e.GetStatus()) && !seen[e.GetChannel()] {
+			seen[e.GetChannel()] = true
+			channels = append(channels, e.GetChannel())
+		}
+	}
+	return channels
+}
+
+// Returns the key a stem is cached under - the MIDI file as it would be written, and the soundfont it's played with
+func stemKey(st stem) (string, error) {
+	var key bytes.Buffer
+	writer := bufio.NewWriter(&key)
+	if err := smfio.Write(writer, st.midi); err != nil {
+		return "", err
+	}
+	if err := writer.Flush(); err != nil {
+		return "", err
+	}
+	key.WriteString(st.soundFont)
+	return key.String(), nil
+}
+
+func readMIDIFile(midiPath string) (*smf.MIDIFile, error) {
+	file, err := os.Open(midiPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return smfio.Read(bufio.NewReader(file))
+}
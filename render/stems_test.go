@@ -0,0 +1,289 @@
+package render
+
+import (
+	"bufio"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/Try431/EasyMIDI/smf"
+	"github.com/Try431/EasyMIDI/smfio"
+	"github.com/Try431/MIDI-part-splitter/audio"
+	"github.com/Try431/MIDI-part-splitter/sf2"
+	"github.com/Try431/MIDI-part-splitter/synth"
+)
+
+// testEvent is a MIDI event at an absolute tick
+type testEvent struct {
+	tick    uint32
+	status  uint8
+	channel uint8
+	data    [2]uint8
+}
+
+func newTestTrack(t *testing.T, events ...testEvent) *smf.Track {
+	var trackEvents []smf.Event
+	previousTick := uint32(0)
+	for _, e := range events {
+		event, err := smf.NewMIDIEvent(e.tick-previousTick, e.status, e.channel, e.data[0], e.data[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		trackEvents = append(trackEvents, event)
+		previousTick = e.tick
+	}
+	endOfTrack, err := smf.NewMetaEvent(0, smf.MetaEndOfTrack, []byte{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	track, err := smf.TrackFromArray(append(trackEvents, endOfTrack))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return track
+}
+
+// Returns a track on a channel that sets its volume and pan, then plays two notes - both notes end at the same tick whatever
+// the channel, so every track of a file ends together
+func partTrack(t *testing.T, channel uint8, volume uint8, pan uint8, key uint8) *smf.Track {
+	return newTestTrack(t,
+		testEvent{0, smf.ProgramChangeStatus, channel, [2]uint8{0, 0}},
+		testEvent{0, smf.ControllerChangeStatus, channel, [2]uint8{volumeController, volume}},
+		testEvent{0, smf.ControllerChangeStatus, channel, [2]uint8{panController, pan}},
+		testEvent{0, smf.NoteOnStatus, channel, [2]uint8{key, 100}},
+		testEvent{480, smf.NoteOffStatus, channel, [2]uint8{key, 0}},
+		testEvent{480, smf.NoteOnStatus, channel, [2]uint8{key + 7, 80}},
+		testEvent{960, smf.NoteOffStatus, channel, [2]uint8{key + 7, 0}},
+	)
+}
+
+func newTestMIDI(t *testing.T, tracks ...*smf.Track) *smf.MIDIFile {
+	division, err := smf.NewDivision(960, smf.NOSMTPE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	midi, err := smf.NewSMF(smf.Format1, *division)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, track := range tracks {
+		midi.AddTrack(track)
+	}
+	return midi
+}
+
+// Returns the value of the first controller change of controller in the track, or -1 if there isn't one
+func controllerValue(track *smf.Track, controller uint8) int {
+	for _, e := range track.GetAllEvents() {
+		if e.GetStatus() == smf.ControllerChangeStatus && e.GetData()[0] == controller {
+			return int(e.GetData()[1])
+		}
+	}
+	return -1
+}
+
+func TestLiftStaticMix(t *testing.T) {
+	t.Run("static volume and pan", func(t *testing.T) {
+		tracks, gain, pan, err := liftStaticMix([]*smf.Track{partTrack(t, 0, 100, 32, 60)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := math.Pow(100.0/127, 2); math.Abs(gain-want) > 1e-9 {
+			t.Errorf("gain = %v, want %v", gain, want)
+		}
+		if pan != -0.5 {
+			t.Errorf("pan = %v, want -0.5", pan)
+		}
+		if volume := controllerValue(tracks[0], volumeController); volume != maxControlValue {
+			t.Errorf("volume left in the track = %d, want %d", volume, maxControlValue)
+		}
+		if p := controllerValue(tracks[0], panController); p != centerPanValue {
+			t.Errorf("pan left in the track = %d, want %d", p, centerPanValue)
+		}
+	})
+
+	t.Run("volume that changes while the channel plays", func(t *testing.T) {
+		track := newTestTrack(t,
+			testEvent{0, smf.ControllerChangeStatus, 0, [2]uint8{volumeController, 100}},
+			testEvent{0, smf.ControllerChangeStatus, 0, [2]uint8{panController, 96}},
+			testEvent{0, smf.NoteOnStatus, 0, [2]uint8{60, 100}},
+			testEvent{480, smf.ControllerChangeStatus, 0, [2]uint8{volumeController, 50}},
+			testEvent{960, smf.NoteOffStatus, 0, [2]uint8{60, 0}},
+		)
+		tracks, gain, pan, err := liftStaticMix([]*smf.Track{track})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gain != 1 {
+			t.Errorf("gain = %v, want 1", gain)
+		}
+		if pan != 0.5 {
+			t.Errorf("pan = %v, want 0.5", pan)
+		}
+		if volume := controllerValue(tracks[0], volumeController); volume != 100 {
+			t.Errorf("volume left in the track = %d, want it unchanged at 100", volume)
+		}
+	})
+
+	t.Run("the last setting on any track of the channel", func(t *testing.T) {
+		layer := newTestTrack(t,
+			testEvent{0, smf.ControllerChangeStatus, 0, [2]uint8{volumeController, 40}},
+			testEvent{0, smf.NoteOnStatus, 0, [2]uint8{72, 100}},
+			testEvent{960, smf.NoteOffStatus, 0, [2]uint8{72, 0}},
+		)
+		_, gain, _, err := liftStaticMix([]*smf.Track{partTrack(t, 0, 100, 64, 60), layer})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := math.Pow(40.0/127, 2); math.Abs(gain-want) > 1e-9 {
+			t.Errorf("gain = %v, want %v", gain, want)
+		}
+	})
+
+	t.Run("no volume or pan", func(t *testing.T) {
+		track := newTestTrack(t, testEvent{0, smf.NoteOnStatus, 0, [2]uint8{60, 100}}, testEvent{960, smf.NoteOffStatus, 0, [2]uint8{60, 0}})
+		tracks, gain, pan, err := liftStaticMix([]*smf.Track{track})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gain != 1 || pan != 0 || tracks[0] != track {
+			t.Errorf("got gain %v, pan %v and a changed track - want gain 1, pan 0 and the track as it was", gain, pan)
+		}
+	})
+}
+
+func TestStemKey(t *testing.T) {
+	stemFor := func(volume uint8, soundFont string) stem {
+		stems, err := splitStems(newTestMIDI(t, partTrack(t, 0, volume, 64, 60)), -1, Config{SoundFont: soundFont})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stems[0]
+	}
+	key := func(st stem) string {
+		k, err := stemKey(st)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+
+	if key(stemFor(100, "a.sf2")) != key(stemFor(40, "a.sf2")) {
+		t.Errorf("versions of a part that only differ in volume have different keys")
+	}
+	if key(stemFor(100, "a.sf2")) == key(stemFor(100, "b.sf2")) {
+		t.Errorf("a part played with different soundfonts has the same key")
+	}
+}
+
+// testSynthesizer plays MIDI files with the built-in synthesizer and a SoundFont built in memory, counting the files it plays
+type testSynthesizer struct {
+	soundFont *sf2.SoundFont
+	lock      sync.Mutex
+	calls     int
+}
+
+func (s *testSynthesizer) synthesize(midi *smf.MIDIFile, soundFont string) (*audio.Buffer, error) {
+	s.lock.Lock()
+	s.calls++
+	s.lock.Unlock()
+	return synth.New(s.soundFont, synth.DefaultSampleRate).Render(midi), nil
+}
+
+// Returns a SoundFont whose only preset loops a sine wave
+func testSoundFont() *sf2.SoundFont {
+	sampleData := make([]int16, 4410)
+	for i := range sampleData {
+		sampleData[i] = int16(16000 * math.Sin(2*math.Pi*float64(i)/100))
+	}
+	sample := &sf2.Sample{Name: "Sine", End: 4410, LoopStart: 100, LoopEnd: 4400, SampleRate: synth.DefaultSampleRate, OriginalPitch: 69}
+	instrument := &sf2.Instrument{Name: "Sine", Zones: []*sf2.Zone{{Generators: map[sf2.Generator]int16{sf2.GenSampleModes: sf2.SampleModeLoop}, Sample: sample}}}
+	preset := &sf2.Preset{Name: "Sine", Zones: []*sf2.Zone{{Generators: map[sf2.Generator]int16{}, Instrument: instrument}}}
+	return &sf2.SoundFont{Presets: []*sf2.Preset{preset}, Instruments: []*sf2.Instrument{instrument}, Samples: []*sf2.Sample{sample}, SampleData: sampleData}
+}
+
+func writeTestMIDI(t *testing.T, dir string, name string, midi *smf.MIDIFile) string {
+	path := filepath.Join(dir, name)
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	if err := smfio.Write(writer, midi); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestStemsMatchFullRender(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stems")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	midi := newTestMIDI(t, partTrack(t, 0, 100, 20, 60), partTrack(t, 1, 64, 100, 64))
+	s := &testSynthesizer{soundFont: testSoundFont()}
+	full, err := s.synthesize(midi, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mixed, err := synthesizeJob(s, Job{MIDIPath: writeTestMIDI(t, dir, "song.mid", midi), LeadTrack: -1}, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.calls != 3 {
+		t.Errorf("synthesized %d files, want 3 - the whole song, then a stem for each part", s.calls)
+	}
+
+	if mixed.Frames() != full.Frames() {
+		t.Fatalf("stems mixed to %d frames, want %d", mixed.Frames(), full.Frames())
+	}
+	// the stems are mixed with the (volume/127)² gain and constant-power pan the synthesizer gives each channel, so the mix
+	// matches the whole song to within a 16-bit step
+	for c := range full.Channels {
+		for i := range full.Channels[c] {
+			if difference := math.Abs(float64(mixed.Channels[c][i] - full.Channels[c][i])); difference > 1.0/32768 {
+				t.Fatalf("channel %d frame %d of the mix is %v, want %v", c, i, mixed.Channels[c][i], full.Channels[c][i])
+			}
+		}
+	}
+}
+
+func TestSongSharesStems(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stems")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the two outputs of a song only differ in which part is turned up
+	jobs := []Job{
+		{MIDIPath: writeTestMIDI(t, dir, "first.mid", newTestMIDI(t, partTrack(t, 0, 127, 64, 60), partTrack(t, 1, 50, 64, 64))), LeadTrack: 0},
+		{MIDIPath: writeTestMIDI(t, dir, "second.mid", newTestMIDI(t, partTrack(t, 0, 50, 64, 60), partTrack(t, 1, 127, 64, 64))), LeadTrack: 1},
+	}
+	s := &testSynthesizer{soundFont: testSoundFont()}
+	song := NewSong(len(jobs))
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		job.Song = song
+		wg.Add(1)
+		go func(job Job) {
+			defer wg.Done()
+			if _, err := synthesizeJob(s, job, Config{}); err != nil {
+				t.Error(err)
+			}
+		}(job)
+	}
+	wg.Wait()
+	if s.calls != 2 {
+		t.Errorf("synthesized %d stems, want 2 - one for each part", s.calls)
+	}
+}
@@ -0,0 +1,113 @@
+package sf2
+
+// Generator is the type of a generator - a setting of a preset or instrument zone, such as its key range or envelope times
+type Generator uint16
+
+// The generators defined by the SoundFont 2 specification, numbered as they are in the file
+const (
+	GenStartAddrsOffset Generator = iota
+	GenEndAddrsOffset
+	GenStartloopAddrsOffset
+	GenEndloopAddrsOffset
+	GenStartAddrsCoarseOffset
+	GenModLfoToPitch
+	GenVibLfoToPitch
+	GenModEnvToPitch
+	GenInitialFilterFc
+	GenInitialFilterQ
+	GenModLfoToFilterFc
+	GenModEnvToFilterFc
+	GenEndAddrsCoarseOffset
+	GenModLfoToVolume
+	genUnused1
+	GenChorusEffectsSend
+	GenReverbEffectsSend
+	GenPan
+	genUnused2
+	genUnused3
+	genUnused4
+	GenDelayModLFO
+	GenFreqModLFO
+	GenDelayVibLFO
+	GenFreqVibLFO
+	GenDelayModEnv
+	GenAttackModEnv
+	GenHoldModEnv
+	GenDecayModEnv
+	GenSustainModEnv
+	GenReleaseModEnv
+	GenKeynumToModEnvHold
+	GenKeynumToModEnvDecay
+	GenDelayVolEnv
+	GenAttackVolEnv
+	GenHoldVolEnv
+	GenDecayVolEnv
+	GenSustainVolEnv
+	GenReleaseVolEnv
+	GenKeynumToVolEnvHold
+	GenKeynumToVolEnvDecay
+	GenInstrument
+	genReserved1
+	GenKeyRange
+	GenVelRange
+	GenStartloopAddrsCoarseOffset
+	GenKeynum
+	GenVelocity
+	GenInitialAttenuation
+	genReserved2
+	GenEndloopAddrsCoarseOffset
+	GenCoarseTune
+	GenFineTune
+	GenSampleID
+	GenSampleModes
+	genReserved3
+	GenScaleTuning
+	GenExclusiveClass
+	GenOverridingRootKey
+	genUnused5
+	genEndOper
+)
+
+// Sample modes set by GenSampleModes
+const (
+	// SampleModeNoLoop plays the sample through once
+	SampleModeNoLoop = 0
+	// SampleModeLoop loops the sample for as long as the note sounds, including its release
+	SampleModeLoop = 1
+	// SampleModeLoopUntilRelease loops the sample while the key is held, then plays the rest of it
+	SampleModeLoopUntilRelease = 3
+)
+
+// Returns the value a generator has when no zone sets it
+func defaultGeneratorValue(g Generator) int32 {
+	switch g {
+	case GenInitialFilterFc:
+		return 13500
+	case GenDelayModLFO, GenDelayVibLFO, GenDelayModEnv, GenAttackModEnv, GenHoldModEnv, GenDecayModEnv, GenReleaseModEnv,
+		GenDelayVolEnv, GenAttackVolEnv, GenHoldVolEnv, GenDecayVolEnv, GenReleaseVolEnv:
+		return -12000
+	case GenKeyRange, GenVelRange:
+		return 127 << 8
+	case GenKeynum, GenVelocity, GenOverridingRootKey:
+		return -1
+	case GenScaleTuning:
+		return 100
+	}
+	return 0
+}
+
+// Reports whether a generator may be used in a preset zone - the rest only make sense for an instrument's own samples
+func isPresetGenerator(g Generator) bool {
+	switch g {
+	case GenStartAddrsOffset, GenEndAddrsOffset, GenStartloopAddrsOffset, GenEndloopAddrsOffset, GenStartAddrsCoarseOffset,
+		GenEndAddrsCoarseOffset, GenStartloopAddrsCoarseOffset, GenEndloopAddrsCoarseOffset, GenKeynum, GenVelocity,
+		GenSampleModes, GenExclusiveClass, GenOverridingRootKey:
+		return false
+	}
+	return g < genEndOper
+}
+
+// Reports whether a generator's amount is a low and high byte range rather than a signed number
+func isRangeGenerator(g Generator) bool {
+	return g == GenKeyRange || g == GenVelRange
+}
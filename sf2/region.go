@@ -0,0 +1,77 @@
+package sf2
+
+// Region is one sample a preset plays for a note, with the generators of the preset and instrument zones it came from combined
+type Region struct {
+	Sample     *Sample
+	generators [genEndOper]int32
+}
+
+// Generator returns the value of a generator for the region
+func (r *Region) Generator(g Generator) int32 {
+	return r.generators[g]
+}
+
+// Regions returns the regions the preset plays for a key and velocity - instrument zones set their generators outright,
+// and preset zones add to them
+func (p *Preset) Regions(key uint8, velocity uint8) []*Region {
+	var regions []*Region
+	for _, presetZone := range p.Zones {
+		if !presetZone.covers(p.GlobalZone, key, velocity) {
+			continue
+		}
+		instrument := presetZone.Instrument
+		for _, instrumentZone := range instrument.Zones {
+			if !instrumentZone.covers(instrument.GlobalZone, key, velocity) {
+				continue
+			}
+
+			region := &Region{Sample: instrumentZone.Sample}
+			for g := Generator(0); g < genEndOper; g++ {
+				region.generators[g] = defaultGeneratorValue(g)
+			}
+			for _, zone := range []*Zone{instrument.GlobalZone, instrumentZone} {
+				if zone == nil {
+					continue
+				}
+				for g, amount := range zone.Generators {
+					region.generators[g] = int32(amount)
+				}
+			}
+
+			// a preset zone's generators replace its global zone's, and the result is added on top of the instrument's
+			presetGenerators := make(map[Generator]int16)
+			for _, zone := range []*Zone{p.GlobalZone, presetZone} {
+				if zone == nil {
+					continue
+				}
+				for g, amount := range zone.Generators {
+					presetGenerators[g] = amount
+				}
+			}
+			for g, amount := range presetGenerators {
+				if isPresetGenerator(g) && !isRangeGenerator(g) && g != GenInstrument {
+					region.generators[g] += int32(amount)
+				}
+			}
+			regions = append(regions, region)
+		}
+	}
+	return regions
+}
+
+// Reports whether a zone plays for a key and velocity - a zone without its own key or velocity range takes its global zone's
+func (z *Zone) covers(globalZone *Zone, key uint8, velocity uint8) bool {
+	return z.inRange(GenKeyRange, globalZone, key) && z.inRange(GenVelRange, globalZone, velocity)
+}
+
+func (z *Zone) inRange(g Generator, globalZone *Zone, value uint8) bool {
+	amount, ok := z.Generators[g]
+	if !ok && globalZone != nil {
+		amount, ok = globalZone.Generators[g]
+	}
+	if !ok {
+		return true
+	}
+	low, high := uint8(uint16(amount)&0xFF), uint8(uint16(amount)>>8)
+	return value >= low && value <= high
+}
@@ -0,0 +1,380 @@
+// Package sf2 reads SoundFont 2 (.sf2) files - the presets they hold, the instruments and samples those presets play,
+// and the settings of each
+package sf2
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// ErrNotSoundFont is returned when parsing a file that isn't a RIFF sfbk file
+var ErrNotSoundFont = errors.New("sf2: not a SoundFont file")
+
+// PercussionBank the bank General MIDI percussion kits are kept in
+const PercussionBank = uint16(128)
+
+// sizes of the records in each of the pdta sub-chunks
+const (
+	presetHeaderSize     = 38
+	bagSize              = 4
+	generatorSize        = 4
+	instrumentHeaderSize = 22
+	sampleHeaderSize     = 46
+)
+
+// SoundFont is a parsed SoundFont 2 file
+type SoundFont struct {
+	// Name the name of the SoundFont bank
+	Name string
+	// Presets the presets in the order they appear in the file
+	Presets []*Preset
+	// Instruments the instruments the presets play
+	Instruments []*Instrument
+	// Samples the headers of the samples the instruments play
+	Samples []*Sample
+	// SampleData every sample's 16-bit sample points, one after the other
+	SampleData []int16
+}
+
+// Preset is a MIDI program in a bank, made up of zones that each play an instrument over a range of keys and velocities
+type Preset struct {
+	Name    string
+	Program uint16
+	Bank    uint16
+	// GlobalZone the settings shared by all the preset's zones (nil if there are none)
+	GlobalZone *Zone
+	Zones      []*Zone
+}
+
+// Instrument is made up of zones that each play a sample over a range of keys and velocities
+type Instrument struct {
+	Name string
+	// GlobalZone the settings shared by all the instrument's zones (nil if there are none)
+	GlobalZone *Zone
+	Zones      []*Zone
+}
+
+// Zone is a set of generators, along with the instrument (in a preset zone) or the sample (in an instrument zone) they apply to
+type Zone struct {
+	// Generators the amount of each generator the zone sets
+	Generators map[Generator]int16
+	Instrument *Instrument
+	Sample     *Sample
+}
+
+// Sample is the header of a sample - its positions are indexes into SoundFont.SampleData
+type Sample struct {
+	Name            string
+	Start           uint32
+	End             uint32
+	LoopStart       uint32
+	LoopEnd         uint32
+	SampleRate      uint32
+	OriginalPitch   uint8
+	PitchCorrection int8
+}
+
+// Open reads and parses the SoundFont file at path
+func Open(path string) (*SoundFont, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// OpenPresets reads the presets, instruments and sample headers of the SoundFont file at path without reading its sample
+// data, which makes up nearly all of the file - it's for looking up what the SoundFont has rather than playing it, so the
+// returned SoundFont's SampleData is empty
+func OpenPresets(path string) (*SoundFont, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(file, header); err != nil || string(header[0:4]) != "RIFF" || string(header[8:12]) != "sfbk" {
+		return nil, ErrNotSoundFont
+	}
+	var lists []chunk
+	chunkHeader := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(file, chunkHeader); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("sf2: chunk runs past the end of the file")
+		}
+		id, size := string(chunkHeader[0:4]), int64(binary.LittleEndian.Uint32(chunkHeader[4:]))
+		// chunks are padded to an even length
+		paddedSize := size + size%2
+		if id != "LIST" || size < 4 {
+			if _, err := file.Seek(paddedSize, io.SeekCurrent); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// a list starts with its type, so the sample data list can be skipped without reading it
+		data := make([]byte, size)
+		if _, err := io.ReadFull(file, data[0:4]); err != nil {
+			return nil, fmt.Errorf("sf2: LIST chunk runs past the end of the file")
+		}
+		if string(data[0:4]) == "sdta" {
+			if _, err := file.Seek(paddedSize-4, io.SeekCurrent); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if _, err := io.ReadFull(file, data[4:]); err != nil {
+			return nil, fmt.Errorf("sf2: %v chunk runs past the end of the file", string(data[0:4]))
+		}
+		lists = append(lists, chunk{id: id, data: data})
+		if _, err := file.Seek(paddedSize-size, io.SeekCurrent); err != nil {
+			return nil, err
+		}
+	}
+	return parseLists(lists, false)
+}
+
+// Parse parses the contents of a SoundFont file - the modulators of the preset and instrument zones (the pmod and imod
+// sub-chunks) are skipped, as nothing that reads the file plays them
+func Parse(data []byte) (*SoundFont, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "sfbk" {
+		return nil, ErrNotSoundFont
+	}
+	lists, err := readChunks(data[12:])
+	if err != nil {
+		return nil, err
+	}
+	return parseLists(lists, true)
+}
+
+// Parses the LIST chunks of a SoundFont file - the sample headers are only checked against the sample data when withSampleData
+// is true, as OpenPresets leaves the sample data out
+func parseLists(lists []chunk, withSampleData bool) (*SoundFont, error) {
+	sf := &SoundFont{}
+	var pdta map[string][]byte
+	for _, list := range lists {
+		if list.id != "LIST" || len(list.data) < 4 {
+			continue
+		}
+		subChunks, err := readChunks(list.data[4:])
+		if err != nil {
+			return nil, err
+		}
+		switch string(list.data[0:4]) {
+		case "INFO":
+			for _, c := range subChunks {
+				if c.id == "INAM" {
+					sf.Name = zeroTerminatedString(c.data)
+				}
+			}
+		case "sdta":
+			for _, c := range subChunks {
+				if c.id == "smpl" {
+					sf.SampleData = make([]int16, len(c.data)/2)
+					for i := range sf.SampleData {
+						sf.SampleData[i] = int16(binary.LittleEndian.Uint16(c.data[i*2:]))
+					}
+				}
+			}
+		case "pdta":
+			pdta = make(map[string][]byte)
+			for _, c := range subChunks {
+				pdta[c.id] = c.data
+			}
+		}
+	}
+	if pdta == nil {
+		return nil, fmt.Errorf("sf2: missing pdta chunk")
+	}
+
+	if err := sf.parseSamples(pdta["shdr"], withSampleData); err != nil {
+		return nil, err
+	}
+	if err := sf.parseInstruments(pdta["inst"], pdta["ibag"], pdta["igen"]); err != nil {
+		return nil, err
+	}
+	if err := sf.parsePresets(pdta["phdr"], pdta["pbag"], pdta["pgen"]); err != nil {
+		return nil, err
+	}
+	return sf, nil
+}
+
+// Preset returns the preset for a bank and program, or nil if the SoundFont doesn't have it
+func (sf *SoundFont) Preset(bank uint16, program uint16) *Preset {
+	for _, preset := range sf.Presets {
+		if preset.Bank == bank && preset.Program == program {
+			return preset
+		}
+	}
+	return nil
+}
+
+// chunk is a RIFF chunk
+type chunk struct {
+	id   string
+	data []byte
+}
+
+// Splits data into the RIFF chunks it's made of
+func readChunks(data []byte) ([]chunk, error) {
+	var chunks []chunk
+	for pos := 0; pos+8 <= len(data); {
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		start := pos + 8
+		if start+size > len(data) {
+			return nil, fmt.Errorf("sf2: %v chunk runs past the end of the file", string(data[pos:pos+4]))
+		}
+		chunks = append(chunks, chunk{id: string(data[pos : pos+4]), data: data[start : start+size]})
+		// chunks are padded to an even length
+		pos = start + size + size%2
+	}
+	return chunks, nil
+}
+
+func (sf *SoundFont) parseSamples(shdr []byte, checkBounds bool) error {
+	count, err := recordCount("shdr", shdr, sampleHeaderSize)
+	if err != nil {
+		return err
+	}
+	// the last record only marks the end of the list
+	for i := 0; i < count-1; i++ {
+		record := shdr[i*sampleHeaderSize:]
+		sample := &Sample{
+			Name:            zeroTerminatedString(record[0:20]),
+			Start:           binary.LittleEndian.Uint32(record[20:]),
+			End:             binary.LittleEndian.Uint32(record[24:]),
+			LoopStart:       binary.LittleEndian.Uint32(record[28:]),
+			LoopEnd:         binary.LittleEndian.Uint32(record[32:]),
+			SampleRate:      binary.LittleEndian.Uint32(record[36:]),
+			OriginalPitch:   record[40],
+			PitchCorrection: int8(record[41]),
+		}
+		if sample.Start > sample.End || (checkBounds && sample.End > uint32(len(sf.SampleData))) {
+			return fmt.Errorf("sf2: sample %v lies outside the sample data", sample.Name)
+		}
+		sf.Samples = append(sf.Samples, sample)
+	}
+	return nil
+}
+
+func (sf *SoundFont) parseInstruments(inst []byte, ibag []byte, igen []byte) error {
+	count, err := recordCount("inst", inst, instrumentHeaderSize)
+	if err != nil {
+		return err
+	}
+	zones, err := parseZones("ibag", ibag, igen)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < count-1; i++ {
+		instrument := &Instrument{Name: zeroTerminatedString(inst[i*instrumentHeaderSize : i*instrumentHeaderSize+20])}
+		firstBag := int(binary.LittleEndian.Uint16(inst[i*instrumentHeaderSize+20:]))
+		lastBag := int(binary.LittleEndian.Uint16(inst[(i+1)*instrumentHeaderSize+20:]))
+		if firstBag > lastBag || lastBag > len(zones) {
+			return fmt.Errorf("sf2: instrument %v has invalid zones", instrument.Name)
+		}
+		for z, zone := range zones[firstBag:lastBag] {
+			sampleID, hasSample := zone.Generators[GenSampleID]
+			switch {
+			case hasSample && int(uint16(sampleID)) < len(sf.Samples):
+				zone.Sample = sf.Samples[uint16(sampleID)]
+				instrument.Zones = append(instrument.Zones, zone)
+			case !hasSample && z == 0:
+				// only the first zone can be a global zone - any other zone without a sample is ignored
+				instrument.GlobalZone = zone
+			}
+		}
+		sf.Instruments = append(sf.Instruments, instrument)
+	}
+	return nil
+}
+
+func (sf *SoundFont) parsePresets(phdr []byte, pbag []byte, pgen []byte) error {
+	count, err := recordCount("phdr", phdr, presetHeaderSize)
+	if err != nil {
+		return err
+	}
+	zones, err := parseZones("pbag", pbag, pgen)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < count-1; i++ {
+		record := phdr[i*presetHeaderSize:]
+		preset := &Preset{
+			Name:    zeroTerminatedString(record[0:20]),
+			Program: binary.LittleEndian.Uint16(record[20:]),
+			Bank:    binary.LittleEndian.Uint16(record[22:]),
+		}
+		firstBag := int(binary.LittleEndian.Uint16(record[24:]))
+		lastBag := int(binary.LittleEndian.Uint16(phdr[(i+1)*presetHeaderSize+24:]))
+		if firstBag > lastBag || lastBag > len(zones) {
+			return fmt.Errorf("sf2: preset %v has invalid zones", preset.Name)
+		}
+		for z, zone := range zones[firstBag:lastBag] {
+			instrumentID, hasInstrument := zone.Generators[GenInstrument]
+			switch {
+			case hasInstrument && int(uint16(instrumentID)) < len(sf.Instruments):
+				zone.Instrument = sf.Instruments[uint16(instrumentID)]
+				preset.Zones = append(preset.Zones, zone)
+			case !hasInstrument && z == 0:
+				preset.GlobalZone = zone
+			}
+		}
+		sf.Presets = append(sf.Presets, preset)
+	}
+	return nil
+}
+
+// Builds the zones listed in a bag sub-chunk from the generators they point to - one zone per bag,
+// not counting the last bag, which only marks the end of the list
+func parseZones(bagChunkID string, bags []byte, generators []byte) ([]*Zone, error) {
+	bagCount, err := recordCount(bagChunkID, bags, bagSize)
+	if err != nil {
+		return nil, err
+	}
+	generatorCount := len(generators) / generatorSize
+
+	var zones []*Zone
+	for b := 0; b < bagCount-1; b++ {
+		firstGenerator := int(binary.LittleEndian.Uint16(bags[b*bagSize:]))
+		lastGenerator := int(binary.LittleEndian.Uint16(bags[(b+1)*bagSize:]))
+		if firstGenerator > lastGenerator || lastGenerator > generatorCount {
+			return nil, fmt.Errorf("sf2: %v zone %d has invalid generators", bagChunkID, b)
+		}
+		zone := &Zone{Generators: make(map[Generator]int16)}
+		for g := firstGenerator; g < lastGenerator; g++ {
+			record := generators[g*generatorSize:]
+			generator := Generator(binary.LittleEndian.Uint16(record))
+			if generator >= genEndOper {
+				continue
+			}
+			zone.Generators[generator] = int16(binary.LittleEndian.Uint16(record[2:]))
+		}
+		zones = append(zones, zone)
+	}
+	return zones, nil
+}
+
+// Returns the number of records in a pdta sub-chunk, which always ends with a terminal record
+func recordCount(chunkID string, data []byte, recordSize int) (int, error) {
+	if len(data) < recordSize || len(data)%recordSize != 0 {
+		return 0, fmt.Errorf("sf2: %v chunk has an invalid size of %d bytes", chunkID, len(data))
+	}
+	return len(data) / recordSize, nil
+}
+
+// Parses a fixed-length, zero-padded string
+func zeroTerminatedString(data []byte) string {
+	if end := strings.IndexByte(string(data), 0); end >= 0 {
+		data = data[:end]
+	}
+	return strings.TrimSpace(string(data))
+}
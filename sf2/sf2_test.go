@@ -0,0 +1,286 @@
+package sf2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testGenerator is a generator record of a zone in a test SoundFont
+type testGenerator struct {
+	generator Generator
+	amount    int16
+}
+
+// Returns the amount of a key or velocity range generator
+func rangeAmount(low uint8, high uint8) int16 {
+	return int16(uint16(low) | uint16(high)<<8)
+}
+
+// Returns a RIFF chunk holding data, padded to an even length
+func riffChunk(id string, data []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString(id)
+	binary.Write(&b, binary.LittleEndian, uint32(len(data)))
+	b.Write(data)
+	if len(data)%2 == 1 {
+		b.WriteByte(0)
+	}
+	return b.Bytes()
+}
+
+// Returns a LIST chunk of the given type holding the chunks
+func listChunk(listType string, chunks ...[]byte) []byte {
+	data := []byte(listType)
+	for _, c := range chunks {
+		data = append(data, c...)
+	}
+	return riffChunk("LIST", data)
+}
+
+// Returns a name padded with zeros to size bytes
+func fixedName(name string, size int) []byte {
+	b := make([]byte, size)
+	copy(b, name)
+	return b
+}
+
+// Builds the bag and generator sub-chunks for a list of zones, each given as its generators
+func zoneChunks(bagID string, genID string, zones [][]testGenerator) ([]byte, []byte) {
+	var bags, gens bytes.Buffer
+	generatorIndex := 0
+	for _, zone := range zones {
+		binary.Write(&bags, binary.LittleEndian, []uint16{uint16(generatorIndex), 0})
+		for _, g := range zone {
+			binary.Write(&gens, binary.LittleEndian, uint16(g.generator))
+			binary.Write(&gens, binary.LittleEndian, g.amount)
+			generatorIndex++
+		}
+	}
+	// terminal records
+	binary.Write(&bags, binary.LittleEndian, []uint16{uint16(generatorIndex), 0})
+	gens.Write(make([]byte, generatorSize))
+	return riffChunk(bagID, bags.Bytes()), riffChunk(genID, gens.Bytes())
+}
+
+// Builds a small SoundFont - two samples, an instrument that plays one below middle C# and the other from it up (with a
+// global zone), a preset playing the instrument (with a global zone of its own), and a percussion preset
+func buildTestSoundFont() []byte {
+	var smpl bytes.Buffer
+	for i := 0; i < 200; i++ {
+		binary.Write(&smpl, binary.LittleEndian, int16(i*100))
+	}
+
+	var shdr bytes.Buffer
+	writeSample := func(name string, start uint32, end uint32, loopStart uint32, loopEnd uint32, pitch uint8, correction int8) {
+		shdr.Write(fixedName(name, 20))
+		binary.Write(&shdr, binary.LittleEndian, []uint32{start, end, loopStart, loopEnd, 22050})
+		shdr.WriteByte(pitch)
+		shdr.WriteByte(byte(correction))
+		binary.Write(&shdr, binary.LittleEndian, []uint16{0, 1})
+	}
+	writeSample("Low", 0, 100, 10, 90, 60, -5)
+	writeSample("High", 100, 200, 110, 190, 72, 0)
+	writeSample("EOS", 0, 0, 0, 0, 0, 0)
+
+	ibag, igen := zoneChunks("ibag", "igen", [][]testGenerator{
+		{{GenInitialAttenuation, 100}, {GenFineTune, 5}},
+		{{GenKeyRange, rangeAmount(0, 60)}, {GenSampleID, 0}},
+		{{GenKeyRange, rangeAmount(61, 127)}, {GenSampleModes, SampleModeLoop}, {GenSampleID, 1}},
+	})
+	var inst bytes.Buffer
+	inst.Write(fixedName("Piano", 20))
+	binary.Write(&inst, binary.LittleEndian, uint16(0))
+	inst.Write(fixedName("EOI", 20))
+	binary.Write(&inst, binary.LittleEndian, uint16(3))
+
+	pbag, pgen := zoneChunks("pbag", "pgen", [][]testGenerator{
+		{{GenFineTune, 10}, {GenVelRange, rangeAmount(0, 100)}},
+		{{GenInstrument, 0}},
+		{{GenKeyRange, rangeAmount(35, 36)}, {GenInstrument, 0}},
+	})
+	var phdr bytes.Buffer
+	writePreset := func(name string, program uint16, bank uint16, firstBag uint16) {
+		phdr.Write(fixedName(name, 20))
+		binary.Write(&phdr, binary.LittleEndian, []uint16{program, bank, firstBag})
+		binary.Write(&phdr, binary.LittleEndian, []uint32{0, 0, 0})
+	}
+	writePreset("Grand", 0, 0, 0)
+	writePreset("Kit", 0, PercussionBank, 2)
+	writePreset("EOP", 0, 0, 3)
+
+	emptyModulators := make([]byte, 10)
+	body := []byte("sfbk")
+	body = append(body, listChunk("INFO", riffChunk("INAM", []byte("Test Font\x00")))...)
+	body = append(body, listChunk("sdta", riffChunk("smpl", smpl.Bytes()))...)
+	body = append(body, listChunk("pdta",
+		riffChunk("phdr", phdr.Bytes()), pbag, riffChunk("pmod", emptyModulators), pgen,
+		riffChunk("inst", inst.Bytes()), ibag, riffChunk("imod", emptyModulators), igen,
+		riffChunk("shdr", shdr.Bytes()),
+	)...)
+	return riffChunk("RIFF", body)
+}
+
+func TestParse(t *testing.T) {
+	sf, err := Parse(buildTestSoundFont())
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	if sf.Name != "Test Font" {
+		t.Errorf("Name = %q, want %q", sf.Name, "Test Font")
+	}
+	if len(sf.SampleData) != 200 || sf.SampleData[150] != 15000 {
+		t.Errorf("SampleData has %d points (point 150 is %d), want 200 (point 150 is 15000)", len(sf.SampleData), sf.SampleData[150])
+	}
+
+	if len(sf.Samples) != 2 {
+		t.Fatalf("got %d samples, want 2", len(sf.Samples))
+	}
+	low := sf.Samples[0]
+	if low.Name != "Low" || low.Start != 0 || low.End != 100 || low.LoopStart != 10 || low.LoopEnd != 90 ||
+		low.SampleRate != 22050 || low.OriginalPitch != 60 || low.PitchCorrection != -5 {
+		t.Errorf("first sample = %+v, want Low from 0 to 100, looping 10-90, at 22050 Hz, pitch 60 corrected by -5", *low)
+	}
+
+	if len(sf.Instruments) != 1 {
+		t.Fatalf("got %d instruments, want 1", len(sf.Instruments))
+	}
+	piano := sf.Instruments[0]
+	if piano.Name != "Piano" || piano.GlobalZone == nil || len(piano.Zones) != 2 {
+		t.Fatalf("instrument = %v with global zone %v and %d zones, want Piano with a global zone and 2 zones", piano.Name, piano.GlobalZone, len(piano.Zones))
+	}
+	if piano.GlobalZone.Generators[GenInitialAttenuation] != 100 {
+		t.Errorf("global zone attenuation = %d, want 100", piano.GlobalZone.Generators[GenInitialAttenuation])
+	}
+	if piano.Zones[0].Sample != sf.Samples[0] || piano.Zones[1].Sample != sf.Samples[1] {
+		t.Errorf("instrument zones don't play the samples they point to")
+	}
+
+	if len(sf.Presets) != 2 {
+		t.Fatalf("got %d presets, want 2", len(sf.Presets))
+	}
+	grand := sf.Presets[0]
+	if grand.Name != "Grand" || grand.Bank != 0 || grand.Program != 0 || grand.GlobalZone == nil || len(grand.Zones) != 1 {
+		t.Errorf("first preset = %v (bank %d, program %d) with %d zones, want Grand (bank 0, program 0) with a global zone and 1 zone",
+			grand.Name, grand.Bank, grand.Program, len(grand.Zones))
+	}
+	if grand.Zones[0].Instrument != piano {
+		t.Errorf("preset zone doesn't play the instrument it points to")
+	}
+}
+
+func TestParseRejectsOtherFiles(t *testing.T) {
+	if _, err := Parse([]byte("RIFF\x04\x00\x00\x00WAVE")); err != ErrNotSoundFont {
+		t.Errorf("Parse() of a wav header returned %v, want ErrNotSoundFont", err)
+	}
+
+	// a file cut off partway through is an error rather than a panic
+	data := buildTestSoundFont()
+	if _, err := Parse(data[:len(data)-100]); err == nil {
+		t.Errorf("Parse() of a truncated file returned no error")
+	}
+}
+
+func TestOpenPresets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sf2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.sf2")
+	if err := ioutil.WriteFile(path, buildTestSoundFont(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sf, err := OpenPresets(path)
+	if err != nil {
+		t.Fatalf("OpenPresets() returned error: %v", err)
+	}
+	if sf.Name != "Test Font" || len(sf.Presets) != 2 || len(sf.Samples) != 2 {
+		t.Fatalf("got %q with %d presets and %d samples, want %q with 2 presets and 2 samples", sf.Name, len(sf.Presets), len(sf.Samples), "Test Font")
+	}
+	if preset := sf.Preset(PercussionBank, 0); preset == nil || preset.Name != "Kit" {
+		t.Errorf("Preset(128, 0) = %v, want Kit", preset)
+	}
+	if len(sf.SampleData) != 0 {
+		t.Errorf("read %d sample points, want none", len(sf.SampleData))
+	}
+
+	data := buildTestSoundFont()
+	if err := ioutil.WriteFile(path, data[:len(data)-100], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenPresets(path); err == nil {
+		t.Errorf("OpenPresets() of a truncated file returned no error")
+	}
+}
+
+func TestPresetLookup(t *testing.T) {
+	sf, err := Parse(buildTestSoundFont())
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	if preset := sf.Preset(PercussionBank, 0); preset == nil || preset.Name != "Kit" {
+		t.Errorf("Preset(128, 0) = %v, want Kit", preset)
+	}
+	if preset := sf.Preset(0, 5); preset != nil {
+		t.Errorf("Preset(0, 5) = %v, want nil", preset.Name)
+	}
+}
+
+func TestRegions(t *testing.T) {
+	sf, err := Parse(buildTestSoundFont())
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	grand := sf.Preset(0, 0)
+
+	tests := []struct {
+		name     string
+		key      uint8
+		velocity uint8
+		sample   string
+	}{
+		{"low key plays the low sample", 60, 80, "Low"},
+		{"high key plays the high sample", 61, 80, "High"},
+		{"velocity outside the preset's global range plays nothing", 60, 101, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			regions := grand.Regions(tt.key, tt.velocity)
+			if tt.sample == "" {
+				if len(regions) != 0 {
+					t.Errorf("got %d regions, want none", len(regions))
+				}
+				return
+			}
+			if len(regions) != 1 || regions[0].Sample.Name != tt.sample {
+				t.Fatalf("got %d regions, want 1 playing %v", len(regions), tt.sample)
+			}
+		})
+	}
+
+	region := grand.Regions(61, 80)[0]
+	generators := []struct {
+		generator Generator
+		want      int32
+	}{
+		// set by the instrument's global zone
+		{GenInitialAttenuation, 100},
+		// set by the instrument zone
+		{GenSampleModes, SampleModeLoop},
+		// set by the instrument's global zone, with the preset's global zone added on top
+		{GenFineTune, 15},
+		// not set by any zone
+		{GenScaleTuning, 100},
+		{GenOverridingRootKey, -1},
+	}
+	for _, g := range generators {
+		if got := region.Generator(g.generator); got != g.want {
+			t.Errorf("Generator(%d) = %d, want %d", g.generator, got, g.want)
+		}
+	}
+}
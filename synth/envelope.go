@@ -0,0 +1,124 @@
+package synth
+
+import (
+	"math"
+)
+
+// the attenuation (in centibels) at which a voice can no longer be heard and is stopped
+const silentAttenuation = 960.0
+
+// stages of a volume envelope
+const (
+	stageDelay = iota
+	stageAttack
+	stageHold
+	stageDecay
+	stageSustain
+	stageRelease
+	stageFinished
+)
+
+// envelope is a SoundFont volume envelope - the attack rises linearly in amplitude, while the decay and release fall
+// linearly in centibels
+type envelope struct {
+	stage int
+	// seconds spent in the current stage
+	elapsed float64
+
+	delay   float64
+	attack  float64
+	hold    float64
+	decay   float64
+	sustain float64
+	release float64
+
+	// amplitude during the attack, from 0 to 1
+	level float64
+	// attenuation in centibels during the decay, sustain and release
+	attenuation float64
+}
+
+// Converts SoundFont timecents to seconds
+func timecentsToSeconds(timecents float64) float64 {
+	return math.Pow(2, timecents/1200)
+}
+
+// Converts centibels of attenuation to an amplitude
+func centibelsToAmplitude(centibels float64) float64 {
+	return math.Pow(10, -centibels/200)
+}
+
+// Moves the envelope on by seconds and returns its amplitude
+func (e *envelope) advance(seconds float64) float64 {
+	e.elapsed += seconds
+	for {
+		switch e.stage {
+		case stageDelay:
+			if e.elapsed < e.delay {
+				return 0
+			}
+			e.nextStage(e.delay)
+		case stageAttack:
+			if e.elapsed < e.attack {
+				e.level = e.elapsed / e.attack
+				return e.level
+			}
+			e.level = 1
+			e.nextStage(e.attack)
+		case stageHold:
+			if e.elapsed < e.hold {
+				return 1
+			}
+			e.nextStage(e.hold)
+		case stageDecay:
+			// the decay time is how long it would take to fall all the way to silence
+			e.attenuation = silentAttenuation * e.elapsed / e.decay
+			if e.attenuation < e.sustain {
+				return centibelsToAmplitude(e.attenuation)
+			}
+			e.attenuation = e.sustain
+			e.stage = stageSustain
+		case stageSustain:
+			if e.sustain >= silentAttenuation {
+				e.stage = stageFinished
+				return 0
+			}
+			return centibelsToAmplitude(e.sustain)
+		case stageRelease:
+			attenuation := e.attenuation + silentAttenuation*e.elapsed/e.release
+			if attenuation >= silentAttenuation {
+				e.stage = stageFinished
+				return 0
+			}
+			return centibelsToAmplitude(attenuation)
+		default:
+			return 0
+		}
+	}
+}
+
+func (e *envelope) nextStage(stageLength float64) {
+	e.elapsed -= stageLength
+	e.stage++
+}
+
+// Starts the release from wherever the envelope has got to
+func (e *envelope) startRelease() {
+	switch e.stage {
+	case stageDelay:
+		e.stage = stageFinished
+		return
+	case stageAttack:
+		if e.level <= 0 {
+			e.stage = stageFinished
+			return
+		}
+		e.attenuation = -200 * math.Log10(e.level)
+	case stageHold:
+		e.attenuation = 0
+	case stageRelease, stageFinished:
+		return
+	}
+	e.stage = stageRelease
+	e.elapsed = 0
+}
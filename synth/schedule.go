@@ -0,0 +1,64 @@
+package synth
+
+import (
+	"sort"
+
+	"github.com/Try431/EasyMIDI/smf"
+)
+
+// the tempo every MIDI file starts at until a Set Tempo meta event says otherwise (120 bpm)
+const defaultMicrosecondsPerQuarter = 500000.0
+
+// scheduledEvent is an event from any track of a MIDI file, with the time in seconds at which it's played
+type scheduledEvent struct {
+	seconds float64
+	event   smf.Event
+}
+
+// Merges the events of every track of a MIDI file into one list in playing order, timed in seconds
+func scheduleEvents(midi *smf.MIDIFile) []scheduledEvent {
+	type tickedEvent struct {
+		tick  uint32
+		event smf.Event
+	}
+	var events []tickedEvent
+	for trackNum := uint16(0); trackNum < midi.GetTracksNum(); trackNum++ {
+		tick := uint32(0)
+		for _, e := range midi.GetTrack(trackNum).GetAllEvents() {
+			tick += e.GetDTime()
+			events = append(events, tickedEvent{tick: tick, event: e})
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].tick < events[j].tick })
+
+	division := midi.GetDivision()
+	// SMPTE divisions count ticks per second instead, and ignore the tempo
+	secondsPerTick := 0.0
+	if division.IsSMTPE() {
+		framesPerSecond := -float64(division.GetSMTPE())
+		if division.GetSMTPE() == smf.SMTPE29 {
+			framesPerSecond = 29.97
+		}
+		secondsPerTick = 1 / (framesPerSecond * float64(division.GetTicks()))
+	}
+	microsecondsPerQuarter := defaultMicrosecondsPerQuarter
+
+	var scheduled []scheduledEvent
+	seconds := 0.0
+	previousTick := uint32(0)
+	for _, te := range events {
+		if division.IsSMTPE() {
+			seconds = float64(te.tick) * secondsPerTick
+		} else {
+			seconds += float64(te.tick-previousTick) * microsecondsPerQuarter / 1e6 / float64(division.GetTicks())
+		}
+		previousTick = te.tick
+
+		if te.event.GetStatus() == smf.MetaStatus && te.event.GetMetaType() == smf.MetaSetTempo && len(te.event.GetData()) == 3 {
+			data := te.event.GetData()
+			microsecondsPerQuarter = float64(uint32(data[0])<<16 | uint32(data[1])<<8 | uint32(data[2]))
+		}
+		scheduled = append(scheduled, scheduledEvent{seconds: seconds, event: te.event})
+	}
+	return scheduled
+}
@@ -0,0 +1,299 @@
+// Package synth plays MIDI files with the presets of a SoundFont, rendering them to audio - it covers sample playback with
+// volume envelopes, looping, key and velocity zones, the low-pass filter, and the SoundFont default modulators for velocity,
+// volume, expression, pan and pitch bend. The modulators a SoundFont defines itself, the LFOs and modulation envelope, and
+// the reverb and chorus sends (controllers 91 and 93) aren't played
+package synth
+
+import (
+	"github.com/Try431/EasyMIDI/smf"
+	"github.com/Try431/MIDI-part-splitter/audio"
+	"github.com/Try431/MIDI-part-splitter/sf2"
+)
+
+// DefaultSampleRate the sample rate audio is rendered at unless another one is given
+const DefaultSampleRate = 44100
+
+// the number of frames rendered between updates of the controllers and envelopes
+const blockSize = 64
+
+// the most voices that can sound at once - the oldest voice is stopped to make room for a new one
+const maxVoices = 256
+
+// the longest the last notes are left to ring out after the end of the MIDI file, in seconds
+const maxTailSeconds = 10
+
+// the overall gain applied to the mix, leaving headroom for many voices sounding at once
+const masterGain = 0.2
+
+// MIDI channel 10 (9 when counting from 0) is reserved for percussion by General MIDI
+const percussionChannel = uint8(9)
+
+// controller numbers the synthesizer responds to
+const (
+	controllerBankSelect    = uint8(0x00)
+	controllerDataEntry     = uint8(0x06)
+	controllerVolume        = uint8(0x07)
+	controllerPan           = uint8(0x0A)
+	controllerExpression    = uint8(0x0B)
+	controllerSustain       = uint8(0x40)
+	controllerRPNLSB        = uint8(0x64)
+	controllerRPNMSB        = uint8(0x65)
+	controllerAllSoundOff   = uint8(0x78)
+	controllerResetAll      = uint8(0x79)
+	controllerAllNotesOff   = uint8(0x7B)
+	rpnPitchBendSensitivity = uint16(0)
+	rpnNull                 = uint16(0x3FFF)
+)
+
+// Synthesizer renders MIDI files with the presets of a SoundFont
+type Synthesizer struct {
+	soundFont  *sf2.SoundFont
+	sampleRate int
+}
+
+// New creates a synthesizer that renders at sampleRate
+func New(soundFont *sf2.SoundFont, sampleRate int) *Synthesizer {
+	return &Synthesizer{soundFont: soundFont, sampleRate: sampleRate}
+}
+
+// channelState is the state of one MIDI channel
+type channelState struct {
+	number     uint8
+	program    uint8
+	bank       uint16
+	volume     uint8
+	expression uint8
+	panValue   uint8
+	sustain    bool
+	// pitch bend from -8192 to 8191, and how many semitones a full bend covers
+	pitchBend      int
+	pitchBendRange float64
+	rpn            uint16
+}
+
+func newChannelState(number uint8) *channelState {
+	c := &channelState{number: number}
+	c.reset()
+	return c
+}
+
+// Sets the controllers back to their defaults - the program and bank are kept
+func (c *channelState) reset() {
+	c.volume = 100
+	c.expression = 127
+	c.panValue = 64
+	c.sustain = false
+	c.pitchBend = 0
+	c.pitchBendRange = 2
+	c.rpn = rpnNull
+}
+
+// Returns the attenuation (in centibels) of the channel's volume and expression controllers
+func (c *channelState) attenuation() float64 {
+	return controllerAttenuation(c.volume) + controllerAttenuation(c.expression)
+}
+
+// Returns the channel's pan from -500 (left) to 500 (right)
+func (c *channelState) pan() float64 {
+	return (float64(c.panValue) - 64) / 64 * 500
+}
+
+func (c *channelState) pitchBendCents() float64 {
+	return float64(c.pitchBend) / 8192 * c.pitchBendRange * 100
+}
+
+// player holds the state of one rendering of a MIDI file
+type player struct {
+	*Synthesizer
+	channels [smf.MaxChannelNumber + 1]*channelState
+	// the sounding voices, oldest first
+	voices []*voice
+	output *audio.Buffer
+	// the frame rendering has reached
+	frame int
+}
+
+// Render plays a MIDI file from start to finish, leaving the last notes to ring out, and returns the stereo audio
+func (s *Synthesizer) Render(midi *smf.MIDIFile) *audio.Buffer {
+	events := scheduleEvents(midi)
+	endFrame := 0
+	if len(events) > 0 {
+		endFrame = s.secondsToFrame(events[len(events)-1].seconds)
+	}
+
+	p := &player{Synthesizer: s, output: audio.NewBuffer(s.sampleRate, 2, endFrame+maxTailSeconds*s.sampleRate)}
+	for ch := range p.channels {
+		p.channels[ch] = newChannelState(uint8(ch))
+	}
+	for _, e := range events {
+		p.renderUntil(s.secondsToFrame(e.seconds))
+		p.handleEvent(e.event)
+	}
+
+	// notes that are never let go of are released at the end of the file
+	for _, v := range p.voices {
+		v.release()
+	}
+	for len(p.voices) > 0 && p.frame < p.output.Frames() {
+		p.renderUntil(p.frame + blockSize)
+	}
+	for c := range p.output.Channels {
+		p.output.Channels[c] = p.output.Channels[c][:p.frame]
+	}
+	return p.output
+}
+
+func (s *Synthesizer) secondsToFrame(seconds float64) int {
+	return int(seconds*float64(s.sampleRate) + 0.5)
+}
+
+// Renders every sounding voice up to frame, a block at a time
+func (p *player) renderUntil(frame int) {
+	if frame > p.output.Frames() {
+		frame = p.output.Frames()
+	}
+	left, right := p.output.Channels[0], p.output.Channels[1]
+	for p.frame < frame {
+		blockEnd := p.frame + blockSize
+		if blockEnd > frame {
+			blockEnd = frame
+		}
+		var soundingVoices []*voice
+		for _, v := range p.voices {
+			v.render(left[p.frame:blockEnd], right[p.frame:blockEnd], p.sampleRate)
+			if !v.finished() {
+				soundingVoices = append(soundingVoices, v)
+			}
+		}
+		p.voices = soundingVoices
+		for i := p.frame; i < blockEnd; i++ {
+			left[i] *= masterGain
+			right[i] *= masterGain
+		}
+		p.frame = blockEnd
+	}
+}
+
+func (p *player) handleEvent(e smf.Event) {
+	if !smf.CheckMIDIStatus(e.GetStatus()) {
+		return
+	}
+	channel := p.channels[e.GetChannel()]
+	data := e.GetData()
+	switch e.GetStatus() {
+	case smf.NoteOnStatus:
+		if data[1] == 0 {
+			p.noteOff(channel, data[0])
+		} else {
+			p.noteOn(channel, data[0], data[1])
+		}
+	case smf.NoteOffStatus:
+		p.noteOff(channel, data[0])
+	case smf.ProgramChangeStatus:
+		channel.program = data[0]
+	case smf.PitchBendStatus:
+		channel.pitchBend = int(data[1])<<7 | int(data[0]) - 8192
+	case smf.ControllerChangeStatus:
+		p.controllerChange(channel, data[0], data[1])
+	}
+}
+
+func (p *player) controllerChange(channel *channelState, controller uint8, value uint8) {
+	switch controller {
+	case controllerBankSelect:
+		channel.bank = uint16(value)
+	case controllerVolume:
+		channel.volume = value
+	case controllerExpression:
+		channel.expression = value
+	case controllerPan:
+		channel.panValue = value
+	case controllerSustain:
+		channel.sustain = value >= 64
+		if !channel.sustain {
+			for _, v := range p.voices {
+				if v.channel == channel && v.sustained {
+					v.sustained = false
+					v.release()
+				}
+			}
+		}
+	case controllerRPNMSB:
+		channel.rpn = channel.rpn&0x7F | uint16(value)<<7
+	case controllerRPNLSB:
+		channel.rpn = channel.rpn&^0x7F | uint16(value)
+	case controllerDataEntry:
+		if channel.rpn == rpnPitchBendSensitivity {
+			channel.pitchBendRange = float64(value)
+		}
+	case controllerAllSoundOff:
+		for _, v := range p.voices {
+			if v.channel == channel {
+				v.cut()
+			}
+		}
+	case controllerAllNotesOff:
+		for _, v := range p.voices {
+			if v.channel == channel && !v.released {
+				v.release()
+			}
+		}
+	case controllerResetAll:
+		channel.reset()
+	}
+}
+
+func (p *player) noteOn(channel *channelState, key uint8, velocity uint8) {
+	preset := p.findPreset(channel)
+	if preset == nil {
+		return
+	}
+	var newVoices []*voice
+	for _, region := range preset.Regions(key, velocity) {
+		newVoices = append(newVoices, newVoice(region, channel, key, velocity, p.soundFont.SampleData, p.sampleRate))
+	}
+	// a note in an exclusive class (e.g., an open hi-hat) stops the notes already sounding in it (e.g., a closed hi-hat)
+	for _, v := range newVoices {
+		if v.exclusiveClass == 0 {
+			continue
+		}
+		for _, other := range p.voices {
+			if other.channel == channel && other.exclusiveClass == v.exclusiveClass {
+				other.cut()
+			}
+		}
+	}
+	p.voices = append(p.voices, newVoices...)
+	if len(p.voices) > maxVoices {
+		p.voices = p.voices[len(p.voices)-maxVoices:]
+	}
+}
+
+func (p *player) noteOff(channel *channelState, key uint8) {
+	for _, v := range p.voices {
+		if v.channel != channel || v.key != key || v.released || v.sustained {
+			continue
+		}
+		if channel.sustain {
+			v.sustained = true
+		} else {
+			v.release()
+		}
+	}
+}
+
+// Returns the preset a channel plays - a channel set to a bank or program the SoundFont doesn't have falls back to the same
+// program in the first bank (or the standard kit, for percussion), and plays nothing if that's missing too
+func (p *player) findPreset(channel *channelState) *sf2.Preset {
+	bank := channel.bank
+	if channel.number == percussionChannel {
+		bank = sf2.PercussionBank
+	}
+	if preset := p.soundFont.Preset(bank, uint16(channel.program)); preset != nil {
+		return preset
+	}
+	if bank == sf2.PercussionBank {
+		return p.soundFont.Preset(sf2.PercussionBank, 0)
+	}
+	return p.soundFont.Preset(0, uint16(channel.program))
+}
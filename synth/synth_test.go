@@ -0,0 +1,270 @@
+package synth
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Try431/EasyMIDI/smf"
+	"github.com/Try431/MIDI-part-splitter/audio"
+	"github.com/Try431/MIDI-part-splitter/sf2"
+)
+
+const testSampleRate = 44100
+
+// the length of the test sample, and where its loop starts and ends
+const (
+	testSampleFrames    = 1000
+	testSampleLoopStart = 100
+	testSampleLoopEnd   = 900
+)
+
+// Returns a SoundFont with one preset (bank 0, program 0) made of an instrument zone per set of generators, each playing the
+// same sine wave sample recorded at middle C
+func testSoundFont(zones ...map[sf2.Generator]int16) *sf2.SoundFont {
+	sampleData := make([]int16, testSampleFrames)
+	for i := range sampleData {
+		sampleData[i] = int16(16000 * math.Sin(2*math.Pi*float64(i)/100))
+	}
+	sample := &sf2.Sample{Name: "Sine", Start: 0, End: testSampleFrames, LoopStart: testSampleLoopStart, LoopEnd: testSampleLoopEnd,
+		SampleRate: testSampleRate, OriginalPitch: 60}
+
+	instrument := &sf2.Instrument{Name: "Test"}
+	for _, generators := range zones {
+		instrument.Zones = append(instrument.Zones, &sf2.Zone{Generators: generators, Sample: sample})
+	}
+	preset := &sf2.Preset{Name: "Test", Zones: []*sf2.Zone{{Generators: map[sf2.Generator]int16{}, Instrument: instrument}}}
+	return &sf2.SoundFont{Presets: []*sf2.Preset{preset}, Instruments: []*sf2.Instrument{instrument}, Samples: []*sf2.Sample{sample},
+		SampleData: sampleData}
+}
+
+// Returns the amount of a key or velocity range generator
+func rangeAmount(low uint8, high uint8) int16 {
+	return int16(uint16(low) | uint16(high)<<8)
+}
+
+func newTestPlayer(soundFont *sf2.SoundFont, seconds float64) *player {
+	s := New(soundFont, testSampleRate)
+	p := &player{Synthesizer: s, output: audio.NewBuffer(testSampleRate, 2, int(seconds*testSampleRate))}
+	for ch := range p.channels {
+		p.channels[ch] = newChannelState(uint8(ch))
+	}
+	return p
+}
+
+func TestZoneSelection(t *testing.T) {
+	soundFont := testSoundFont(
+		map[sf2.Generator]int16{sf2.GenKeyRange: rangeAmount(0, 59), sf2.GenPan: -500},
+		map[sf2.Generator]int16{sf2.GenKeyRange: rangeAmount(60, 127), sf2.GenVelRange: rangeAmount(0, 63), sf2.GenPan: 0},
+		map[sf2.Generator]int16{sf2.GenKeyRange: rangeAmount(60, 127), sf2.GenVelRange: rangeAmount(64, 127), sf2.GenPan: 500},
+	)
+	tests := []struct {
+		name     string
+		key      uint8
+		velocity uint8
+		pan      float64
+	}{
+		{"low key", 40, 100, -500},
+		{"high key played softly", 72, 40, 0},
+		{"high key played loudly", 72, 100, 500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPlayer(soundFont, 1)
+			p.noteOn(p.channels[0], tt.key, tt.velocity)
+			if len(p.voices) != 1 {
+				t.Fatalf("got %d voices, want 1", len(p.voices))
+			}
+			if p.voices[0].pan != tt.pan {
+				t.Errorf("voice came from the zone panned to %v, want the zone panned to %v", p.voices[0].pan, tt.pan)
+			}
+		})
+	}
+}
+
+func TestVoicePitch(t *testing.T) {
+	p := newTestPlayer(testSoundFont(map[sf2.Generator]int16{}), 1)
+	p.noteOn(p.channels[0], 72, 100)
+	// an octave above the sample's own pitch plays it twice as fast
+	if got := p.voices[0].baseStep * math.Pow(2, p.voices[0].pitchCents/1200); math.Abs(got-2) > 1e-9 {
+		t.Errorf("playback speed = %v, want 2", got)
+	}
+}
+
+func TestLoopModes(t *testing.T) {
+	// long enough that the envelope isn't what stops any of the voices
+	longRelease := int16(1200)
+	tests := []struct {
+		name             string
+		loopMode         int16
+		finishedWhenHeld bool
+		finishedReleased bool
+	}{
+		{"no loop plays the sample once", sf2.SampleModeNoLoop, true, true},
+		{"loop plays on through the release", sf2.SampleModeLoop, false, false},
+		{"loop until release plays the rest of the sample once let go of", sf2.SampleModeLoopUntilRelease, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestPlayer(testSoundFont(map[sf2.Generator]int16{sf2.GenSampleModes: tt.loopMode, sf2.GenReleaseVolEnv: longRelease}), 1)
+			p.noteOn(p.channels[0], 60, 100)
+			v := p.voices[0]
+
+			// the sample lasts testSampleFrames frames at its own pitch, so twice that is well past its end
+			p.renderUntil(2 * testSampleFrames)
+			if v.finished() != tt.finishedWhenHeld {
+				t.Errorf("held voice finished = %v, want %v", v.finished(), tt.finishedWhenHeld)
+			}
+
+			p.noteOff(p.channels[0], 60)
+			p.renderUntil(4 * testSampleFrames)
+			if v.finished() != tt.finishedReleased {
+				t.Errorf("released voice finished = %v, want %v", v.finished(), tt.finishedReleased)
+			}
+		})
+	}
+}
+
+func TestEnvelope(t *testing.T) {
+	e := envelope{delay: 0.1, attack: 0.2, hold: 0.1, decay: 1, sustain: 480, release: 0.5}
+
+	if level := e.advance(0.05); level != 0 {
+		t.Errorf("level during the delay = %v, want 0", level)
+	}
+	// halfway through the attack, which rises linearly
+	if level := e.advance(0.15); math.Abs(level-0.5) > 1e-9 {
+		t.Errorf("level halfway through the attack = %v, want 0.5", level)
+	}
+	if level := e.advance(0.15); level != 1 {
+		t.Errorf("level during the hold = %v, want 1", level)
+	}
+	// the decay falls silentAttenuation centibels over its length, so it passes 240 cB a quarter of the way in
+	if level := e.advance(0.05 + 0.25); math.Abs(level-centibelsToAmplitude(240)) > 1e-9 {
+		t.Errorf("level a quarter of the way through the decay = %v, want %v", level, centibelsToAmplitude(240))
+	}
+	if level := e.advance(1); math.Abs(level-centibelsToAmplitude(480)) > 1e-9 || e.stage != stageSustain {
+		t.Errorf("level after the decay = %v in stage %d, want %v in the sustain stage", level, e.stage, centibelsToAmplitude(480))
+	}
+
+	// the release falls from the sustain level at the same rate, so it's silent after (960-480)/960 of its length
+	e.startRelease()
+	if level := e.advance(0.2); math.Abs(level-centibelsToAmplitude(480+0.2/0.5*silentAttenuation)) > 1e-9 {
+		t.Errorf("level during the release = %v, want %v", level, centibelsToAmplitude(480+0.2/0.5*silentAttenuation))
+	}
+	if level := e.advance(0.1); level != 0 || e.stage != stageFinished {
+		t.Errorf("level after the release = %v in stage %d, want 0 and finished", level, e.stage)
+	}
+}
+
+func TestReleaseDuringAttack(t *testing.T) {
+	e := envelope{attack: 1, release: 1}
+	e.advance(0.5)
+	e.startRelease()
+	// the release starts from the level the attack had reached rather than jumping to full
+	if level := e.advance(0); math.Abs(level-0.5) > 1e-9 {
+		t.Errorf("level at the start of the release = %v, want 0.5", level)
+	}
+
+	e = envelope{delay: 1, attack: 1, release: 1}
+	e.advance(0.5)
+	e.startRelease()
+	if !(&voice{envelope: e}).finished() {
+		t.Errorf("a note let go of before it started should be finished")
+	}
+}
+
+func TestExclusiveClass(t *testing.T) {
+	soundFont := testSoundFont(
+		map[sf2.Generator]int16{sf2.GenKeyRange: rangeAmount(42, 42), sf2.GenExclusiveClass: 1, sf2.GenReleaseVolEnv: 1200},
+		map[sf2.Generator]int16{sf2.GenKeyRange: rangeAmount(46, 46), sf2.GenExclusiveClass: 1, sf2.GenReleaseVolEnv: 1200},
+		map[sf2.Generator]int16{sf2.GenKeyRange: rangeAmount(50, 50), sf2.GenReleaseVolEnv: 1200},
+	)
+	p := newTestPlayer(soundFont, 1)
+	channel := p.channels[0]
+	p.noteOn(channel, 42, 100)
+	p.noteOn(channel, 50, 100)
+	closed, other := p.voices[0], p.voices[1]
+	p.noteOn(p.channels[1], 46, 100)
+	if closed.released {
+		t.Errorf("a note in the same exclusive class on another channel stopped the note")
+	}
+
+	p.noteOn(channel, 46, 100)
+	if !closed.released {
+		t.Errorf("a note in the same exclusive class didn't stop the note")
+	}
+	if other.released {
+		t.Errorf("a note outside the exclusive class was stopped")
+	}
+	// the note is cut off quickly rather than playing its own long release
+	p.renderUntil(testSampleRate / 20)
+	if !closed.finished() {
+		t.Errorf("the stopped note was still sounding 50 ms later")
+	}
+}
+
+func TestSustainPedal(t *testing.T) {
+	p := newTestPlayer(testSoundFont(map[sf2.Generator]int16{sf2.GenSampleModes: sf2.SampleModeLoop}), 1)
+	channel := p.channels[0]
+	p.controllerChange(channel, controllerSustain, 127)
+	p.noteOn(channel, 60, 100)
+	p.noteOff(channel, 60)
+	if p.voices[0].released {
+		t.Errorf("note was let go of while the sustain pedal was down")
+	}
+	p.controllerChange(channel, controllerSustain, 0)
+	if !p.voices[0].released {
+		t.Errorf("note wasn't let go of when the sustain pedal came up")
+	}
+}
+
+func TestRender(t *testing.T) {
+	division, err := smf.NewDivision(960, smf.NOSMTPE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	midi, err := smf.NewSMF(smf.Format0, *division)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []smf.Event
+	for _, e := range []struct {
+		deltaTime uint32
+		status    uint8
+		data      [2]uint8
+	}{
+		{0, smf.NoteOnStatus, [2]uint8{60, 100}},
+		// a quarter note at the default 120 bpm lasts half a second
+		{960, smf.NoteOffStatus, [2]uint8{60, 0}},
+	} {
+		event, err := smf.NewMIDIEvent(e.deltaTime, e.status, 0, e.data[0], e.data[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+	endOfTrack, err := smf.NewMetaEvent(0, smf.MetaEndOfTrack, []byte{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	track, err := smf.TrackFromArray(append(events, endOfTrack))
+	if err != nil {
+		t.Fatal(err)
+	}
+	midi.AddTrack(track)
+
+	buffer := New(testSoundFont(map[sf2.Generator]int16{sf2.GenSampleModes: sf2.SampleModeLoop}), testSampleRate).Render(midi)
+	if len(buffer.Channels) != 2 {
+		t.Fatalf("got %d channels, want 2", len(buffer.Channels))
+	}
+	// the note plays for half a second, then rings out through its (default, very short) release
+	if frames := buffer.Frames(); frames < testSampleRate/2 || frames > testSampleRate/2+testSampleRate/10 {
+		t.Errorf("got %d frames, want just over %d", frames, testSampleRate/2)
+	}
+	peak := 0.0
+	for _, sample := range buffer.Channels[0][:testSampleRate/2] {
+		peak = math.Max(peak, math.Abs(float64(sample)))
+	}
+	if peak == 0 {
+		t.Errorf("rendered note is silent")
+	}
+}
@@ -0,0 +1,223 @@
+package synth
+
+import (
+	"math"
+
+	"github.com/Try431/MIDI-part-splitter/sf2"
+)
+
+// voice is one region of a preset playing one note
+type voice struct {
+	channel *channelState
+	key     uint8
+
+	data      []int16
+	position  float64
+	end       int
+	loopStart int
+	loopEnd   int
+	loopMode  int32
+
+	// the pitch of the note relative to the sample's own, in cents, before pitch bend
+	pitchCents float64
+	// the playback speed at the sample's own pitch
+	baseStep float64
+	// the region's own attenuation (in centibels), including the note's velocity
+	attenuation float64
+	// the region's own pan, from -500 (left) to 500 (right)
+	pan float64
+
+	envelope       envelope
+	exclusiveClass int32
+	// the note was let go of while the sustain pedal was down
+	sustained bool
+	released  bool
+	filter    *lowPassFilter
+
+	// the amplitude the previous block ended on, so each block can ramp smoothly from it
+	lastGain float64
+}
+
+// Sets up a voice for a region of a preset
+func newVoice(region *sf2.Region, channel *channelState, key uint8, velocity uint8, sampleData []int16, sampleRate int) *voice {
+	sample := region.Sample
+	gen := func(g sf2.Generator) int32 { return region.Generator(g) }
+	addressOffset := func(fine sf2.Generator, coarse sf2.Generator) int {
+		return int(gen(fine)) + 32768*int(gen(coarse))
+	}
+
+	v := &voice{
+		channel:        channel,
+		key:            key,
+		data:           sampleData,
+		position:       float64(int(sample.Start) + addressOffset(sf2.GenStartAddrsOffset, sf2.GenStartAddrsCoarseOffset)),
+		end:            int(sample.End) + addressOffset(sf2.GenEndAddrsOffset, sf2.GenEndAddrsCoarseOffset),
+		loopStart:      int(sample.LoopStart) + addressOffset(sf2.GenStartloopAddrsOffset, sf2.GenStartloopAddrsCoarseOffset),
+		loopEnd:        int(sample.LoopEnd) + addressOffset(sf2.GenEndloopAddrsOffset, sf2.GenEndloopAddrsCoarseOffset),
+		loopMode:       gen(sf2.GenSampleModes),
+		pan:            float64(gen(sf2.GenPan)),
+		exclusiveClass: gen(sf2.GenExclusiveClass),
+	}
+	// keep every position inside the sample data, whatever the offsets say
+	v.end = clamp(v.end, 0, len(sampleData))
+	v.position = math.Max(0, math.Min(v.position, float64(v.end)))
+	v.loopStart = clamp(v.loopStart, 0, v.end)
+	v.loopEnd = clamp(v.loopEnd, v.loopStart, v.end)
+	if v.loopEnd-v.loopStart < 2 {
+		v.loopMode = sf2.SampleModeNoLoop
+	}
+
+	// a region can play every key at the same pitch, or at a velocity of its own
+	pitchKey := float64(key)
+	if gen(sf2.GenKeynum) >= 0 {
+		pitchKey = float64(gen(sf2.GenKeynum))
+	}
+	if gen(sf2.GenVelocity) >= 0 {
+		velocity = uint8(gen(sf2.GenVelocity))
+	}
+	rootKey := float64(sample.OriginalPitch)
+	if gen(sf2.GenOverridingRootKey) >= 0 {
+		rootKey = float64(gen(sf2.GenOverridingRootKey))
+	}
+	v.pitchCents = (pitchKey-rootKey)*float64(gen(sf2.GenScaleTuning)) + float64(gen(sf2.GenCoarseTune))*100 +
+		float64(gen(sf2.GenFineTune)) + float64(sample.PitchCorrection)
+	v.baseStep = float64(sample.SampleRate) / float64(sampleRate)
+
+	// like most SoundFont players, only 40% of the initial attenuation is applied, which is how the files are voiced;
+	// the default velocity modulator then adds the same attenuation curve as the volume and expression controllers
+	v.attenuation = 0.4*float64(gen(sf2.GenInitialAttenuation)) + controllerAttenuation(velocity)
+
+	v.envelope = envelope{
+		delay:   timecentsToSeconds(float64(gen(sf2.GenDelayVolEnv))),
+		attack:  timecentsToSeconds(float64(gen(sf2.GenAttackVolEnv))),
+		hold:    timecentsToSeconds(float64(gen(sf2.GenHoldVolEnv) + gen(sf2.GenKeynumToVolEnvHold)*(60-int32(key)))),
+		decay:   timecentsToSeconds(float64(gen(sf2.GenDecayVolEnv) + gen(sf2.GenKeynumToVolEnvDecay)*(60-int32(key)))),
+		sustain: math.Max(0, float64(gen(sf2.GenSustainVolEnv))),
+		release: timecentsToSeconds(float64(gen(sf2.GenReleaseVolEnv))),
+	}
+
+	// the default velocity modulator closes the filter by up to two octaves for soft notes
+	cutoffCents := float64(gen(sf2.GenInitialFilterFc)) - 2400*(1-float64(velocity)/127)
+	if gen(sf2.GenInitialFilterFc) < 13500 {
+		v.filter = newLowPassFilter(cutoffCents, float64(gen(sf2.GenInitialFilterQ)), sampleRate)
+	}
+	return v
+}
+
+// Returns the attenuation (in centibels) General MIDI expects for a velocity or for a volume or expression controller value -
+// the amplitude follows the square of the value
+func controllerAttenuation(value uint8) float64 {
+	if value == 0 {
+		return silentAttenuation
+	}
+	return math.Min(silentAttenuation, -400*math.Log10(float64(value)/127))
+}
+
+// Lets go of the note - the voice plays on through its release
+func (v *voice) release() {
+	v.released = true
+	v.envelope.startRelease()
+}
+
+// Stops the voice almost straight away, e.g., when another note in its exclusive class starts
+func (v *voice) cut() {
+	v.envelope.release = 0.005
+	v.release()
+}
+
+func (v *voice) finished() bool {
+	return v.envelope.stage == stageFinished
+}
+
+// Mixes the next frames of the voice into the left and right channels
+func (v *voice) render(left []float32, right []float32, sampleRate int) {
+	frames := len(left)
+	if v.finished() {
+		return
+	}
+
+	step := v.baseStep * math.Pow(2, (v.pitchCents+v.channel.pitchBendCents())/1200)
+	gain := centibelsToAmplitude(v.attenuation+v.channel.attenuation()) * v.envelope.advance(float64(frames)/float64(sampleRate))
+	gainStep := (gain - v.lastGain) / float64(frames)
+	leftGain, rightGain := panGains(v.pan + v.channel.pan())
+
+	looping := v.loopMode == sf2.SampleModeLoop || (v.loopMode == sf2.SampleModeLoopUntilRelease && !v.released)
+	currentGain := v.lastGain
+	for i := 0; i < frames; i++ {
+		index := int(v.position)
+		for looping && index >= v.loopEnd {
+			v.position -= float64(v.loopEnd - v.loopStart)
+			index = int(v.position)
+		}
+		if index+1 >= v.end {
+			v.envelope.stage = stageFinished
+			break
+		}
+
+		// linear interpolation between the two sample points either side of the position
+		next := index + 1
+		if looping && next >= v.loopEnd {
+			next = v.loopStart
+		}
+		fraction := v.position - float64(index)
+		sample := (float64(v.data[index]) + (float64(v.data[next])-float64(v.data[index]))*fraction) / 32768
+		if v.filter != nil {
+			sample = v.filter.process(sample)
+		}
+
+		currentGain += gainStep
+		left[i] += float32(sample * currentGain * leftGain)
+		right[i] += float32(sample * currentGain * rightGain)
+		v.position += step
+	}
+	v.lastGain = gain
+}
+
+// Returns the left and right gains for a pan from -500 (left) to 500 (right), keeping the overall power the same
+func panGains(pan float64) (float64, float64) {
+	pan = math.Max(-500, math.Min(500, pan))
+	angle := (pan + 500) / 1000 * math.Pi / 2
+	return math.Cos(angle), math.Sin(angle)
+}
+
+func clamp(value int, low int, high int) int {
+	if value < low {
+		return low
+	}
+	if value > high {
+		return high
+	}
+	return value
+}
+
+// lowPassFilter is a resonant two-pole low-pass filter
+type lowPassFilter struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+// Creates a filter with its cutoff in absolute cents (as SoundFont filter cutoffs are given) and its resonance in centibels
+func newLowPassFilter(cutoffCents float64, resonance float64, sampleRate int) *lowPassFilter {
+	cutoff := 8.176 * math.Pow(2, cutoffCents/1200)
+	cutoff = math.Max(20, math.Min(cutoff, 0.45*float64(sampleRate)))
+	q := math.Max(math.Sqrt(0.5), math.Pow(10, resonance/200))
+
+	omega := 2 * math.Pi * cutoff / float64(sampleRate)
+	alpha := math.Sin(omega) / (2 * q)
+	cosOmega := math.Cos(omega)
+	a0 := 1 + alpha
+	return &lowPassFilter{
+		b0: (1 - cosOmega) / 2 / a0,
+		b1: (1 - cosOmega) / a0,
+		b2: (1 - cosOmega) / 2 / a0,
+		a1: -2 * cosOmega / a0,
+		a2: (1 - alpha) / a0,
+	}
+}
+
+func (f *lowPassFilter) process(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+	return y
+}